@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
@@ -11,7 +12,10 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -26,6 +30,9 @@ func main() {
 	fmt.Printf("Starting server...\n")
 	fmt.Printf("APP_URL: %s\n", appURL)
 	fmt.Printf("Redirect URL: %s\n", config.OauthConf.RedirectURL)
+	if config.GitBackend == "gogit" && !services.GitBinaryAvailable() {
+		fmt.Printf("git is not installed: history, discard, conflict resolution and the editorial workflow are unavailable\n")
+	}
 
 	r := gin.Default()
 
@@ -56,10 +63,20 @@ func main() {
 	if err := services.StartHugoServer(); err != nil {
 		fmt.Printf("Failed to start Hugo Server: %v\n", err)
 	}
+	services.StartAutoSync()
+	services.StartWatcher()
+	// Load the article list from the on-disk index before the first editor asks
+	go services.GetArticlesCache()
 
 	// Proxy /preview/ to Hugo Server
 	previewProxyURL, _ := url.Parse("http://" + config.HugoServerBind + ":" + config.HugoServerPort)
 	proxy := httputil.NewSingleHostReverseProxy(previewProxyURL)
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		// The supervisor restarts hugo; tell the editor instead of a bare 502
+		fmt.Printf("[Proxy] Preview unavailable: %v\n", err)
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "Preview server is (re)starting, please retry in a moment.", http.StatusServiceUnavailable)
+	}
 
 	r.Any(config.PreviewURL+"*path", func(c *gin.Context) {
 		proxy.ServeHTTP(c.Writer, c.Request)
@@ -73,30 +90,88 @@ func main() {
 	r.GET("/auth/callback", handlers.AuthCallback)
 	r.GET("/logout", handlers.Logout)
 
+	// --- Webhooks (authenticated by signature) ---
+	r.POST("/hooks/github", handlers.GitHubWebhook)
+
 	// --- Main App (Authorized) ---
 	authorized := r.Group("/")
 	authorized.Use(handlers.AuthRequired)
 	{
-		authorized.GET("/", func(c *gin.Context) { c.HTML(http.StatusOK, "index.html", nil) })
+		authorized.GET("/", func(c *gin.Context) {
+			c.HTML(http.StatusOK, "index.html", gin.H{"PublishMode": config.PublishMode})
+		})
+		authorized.Any(config.DraftPreviewURL+":session/*path", handlers.ProxyDraftPreview)
 
 		api := authorized.Group("/api")
 		{
 			api.POST("/build", handlers.HandleBuild)
+			api.GET("/builds", handlers.ListBuilds)
+			api.GET("/builds/:id", handlers.GetBuild)
 			api.GET("/articles", handlers.ListArticles)
+			api.GET("/search", handlers.Search)
 			api.GET("/article", handlers.GetArticle)
-			api.POST("/article", handlers.SaveArticle)
-			api.POST("/create", handlers.CreateArticle)
-			api.POST("/delete", handlers.DeleteArticle)
+			api.GET("/article/preview-url", handlers.GetArticlePreviewURL)
+			api.POST("/article", handlers.Serialize("save", false), handlers.BlockDuringMerge, handlers.SaveArticle)
+			api.POST("/create", handlers.Serialize("create", false), handlers.BlockDuringMerge, handlers.CreateArticle)
+			api.POST("/delete", handlers.Serialize("delete", false), handlers.BlockDuringMerge, handlers.DeleteArticle)
 			api.POST("/diff", handlers.GetDiff)
+			api.GET("/article/history", handlers.RequireGitBinary, handlers.GetArticleHistory)
+			api.GET("/article/revision", handlers.RequireGitBinary, handlers.GetArticleRevision)
+			api.POST("/article/restore", handlers.RequireGitBinary, handlers.Serialize("restore", false), handlers.BlockDuringMerge, handlers.RestoreArticle)
 			api.GET("/config", handlers.GetConfig)
-			api.POST("/sync", handlers.HandleSync)
-			api.POST("/publish", handlers.HandlePublish)
+			api.POST("/sync", handlers.Serialize("sync", true), handlers.HandleSync)
+			api.POST("/publish", handlers.Serialize("publish", false), handlers.BlockDuringMerge, handlers.HandlePublish)
+			api.GET("/changes", handlers.ListChanges)
+			api.GET("/git/status", handlers.GetGitStatus)
+			api.GET("/git/remote", handlers.Serialize("remote-status", false), handlers.GetRemoteStatus)
+			api.POST("/git/push", handlers.Serialize("push", true), handlers.PushPending)
+			api.POST("/discard", handlers.RequireGitBinary, handlers.Serialize("discard", false), handlers.BlockDuringMerge, handlers.DiscardChanges)
 			api.GET("/media", handlers.ListMedia)
-			api.POST("/media", handlers.UploadMedia)
-			api.POST("/media/delete", handlers.DeleteMedia)
+			api.POST("/media", handlers.Serialize("upload-media", false), handlers.BlockDuringMerge, handlers.UploadMedia)
+			api.POST("/media/delete", handlers.Serialize("delete-media", false), handlers.BlockDuringMerge, handlers.DeleteMedia)
 			api.GET("/media/raw", handlers.ServeMediaRaw)
+			api.GET("/preview/status", handlers.GetPreviewStatus)
+			api.POST("/preview/restart", handlers.RestartPreview)
+			api.GET("/preview/draft", handlers.GetDraftPreviewStatus)
+			api.POST("/preview/draft", handlers.UpdateDraftPreview)
+			api.DELETE("/preview/draft", handlers.DiscardDraftPreview)
+			api.GET("/events/hugo", handlers.StreamHugoEvents)
+			api.GET("/events/files", handlers.StreamFileEvents)
+			api.GET("/conflicts", handlers.ListConflicts)
+			api.POST("/conflicts/resolve", handlers.RequireGitBinary, handlers.Serialize("resolve-conflict", false), handlers.ResolveConflict)
+			api.POST("/conflicts/abort", handlers.RequireGitBinary, handlers.Serialize("abort-merge", true), handlers.AbortMerge)
+
+			// Editorial workflow
+			api.GET("/workflow/entries", handlers.RequireGitBinary, handlers.ListWorkflowEntries)
+			api.POST("/workflow/publish", handlers.RequireGitBinary, handlers.Serialize("workflow-publish", false), handlers.PublishWorkflowEntry)
+			api.POST("/workflow/status", handlers.RequireGitBinary, handlers.UpdateWorkflowStatus)
+			api.POST("/workflow/merge", handlers.RequireGitBinary, handlers.Serialize("workflow-merge", false), handlers.BlockDuringMerge, handlers.MergeWorkflowEntry)
 		}
 	}
 
-	r.Run(":8080")
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	// Event streams never go idle, so end them or Shutdown waits for its timeout
+	srv.RegisterOnShutdown(services.CloseEventStreams)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Server error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Stop hugo together with the CMS instead of leaving it orphaned
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	fmt.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Server shutdown error: %v\n", err)
+	}
+	services.StopHugoServer()
+	services.StopDraftPreviews()
+	services.StopWatcher()
+	services.CloseIndex()
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
@@ -18,10 +20,36 @@ var (
 	// Hugo Server settings
 	HugoServerPort = "1314"
 	HugoServerBind = "127.0.0.1"
+	// Lines of hugo server output kept for GET /api/preview/status
+	HugoLogLines = 200
+
+	// Draft preview: unsaved editor content is rendered by a hugo server per
+	// editor session, on ports from DraftPreviewPort up. DraftPreviewMax
+	// limits the servers running at once (0 disables draft previews);
+	// idle ones are stopped after DraftPreviewIdle.
+	DraftPreviewURL  = "/preview-draft/"
+	DraftPreviewPort = 1315
+	DraftPreviewMax  = 3
+	DraftPreviewIdle = 15 * time.Minute
+
+	// Directory for data the CMS keeps outside the repository (builds, index)
+	CMSDataDir = "./data"
+
+	// Production builds: number of build outputs kept, and where a
+	// successful build is deployed. DeployMethod is "" (no deploy), "local"
+	// (replace the DeployPath directory) or "rsync" (rsync to DeployPath,
+	// which may be remote, e.g. "user@host:/var/www/site").
+	BuildKeep    = 5
+	DeployMethod = ""
+	DeployPath   = ""
 
 	// Cache settings
-	CacheConcurrency  = 20
-	FileReadHeadLimit = int64(4096)
+	CacheConcurrency = 20
+	// Watch content/ and static/ so changes made outside the CMS (git pull,
+	// hugo new, a shell on the server) reach the cache; events are batched
+	// until nothing changed for WatchDebounce
+	FileWatcher   = true
+	WatchDebounce = 500 * time.Millisecond
 
 	// Media settings
 	ArticleMediaDir = ""
@@ -32,6 +60,45 @@ var (
 	GitUserName  = "Hugo CMS Bot"
 	GitBranch    = "main"
 	GitRemote    = "origin"
+	// Additional remotes that receive every published commit
+	GitMirrorRemotes []string
+	// GitBotRole decides how the bot appears on commits made for an editor:
+	// "committer" (editor is author, bot is committer) or "coauthor"
+	// (editor is author and committer, bot is added as a Co-authored-by trailer).
+	GitBotRole = "committer"
+	// GitBackend selects how git is driven: "exec" (the git binary) or
+	// "gogit" (pure Go, no git binary needed for status, commit, push and pull).
+	GitBackend = "exec"
+
+	// Maximum number of git operations waiting in the repository queue
+	GitQueueSize = 20
+
+	// Number of times a rejected push is rebased and retried
+	PushRetries = 3
+
+	// Background sync: fetch interval (0 disables it) and the server-side
+	// credential used instead of an editor's OAuth token
+	AutoSyncInterval = time.Duration(0)
+	GitSyncToken     = ""
+
+	// Credentials for remote git operations: "oauth" (the editor's token),
+	// "github_app" (installation token of a GitHub App) or "deploy_key" (SSH).
+	// In the last two modes OAuth is only used to identify editors.
+	GitAuthMode             = "oauth"
+	GitHubAppID             = ""
+	GitHubAppInstallationID = ""
+	GitHubAppPrivateKeyPath = ""
+	GitDeployKeyPath        = ""
+	GitSSHKnownHosts        = ""
+
+	// Secret of the GitHub push webhook (POST /hooks/github); empty disables it
+	GitHubWebhookSecret = ""
+
+	// Publish settings
+	// PublishMode is "simple" (commit straight to GitBranch) or
+	// "editorial_workflow" (per-article branches and pull requests).
+	PublishMode  = "simple"
+	GitHubAPIURL = "https://api.github.com"
 )
 
 var OauthConf *oauth2.Config
@@ -59,6 +126,15 @@ func Init() {
 	HugoServerPort = getEnv("HUGO_SERVER_PORT", "1314")
 	HugoServerBind = getEnv("HUGO_SERVER_BIND", "127.0.0.1")
 
+	CMSDataDir = getEnv("CMS_DATA_DIR", "./data")
+	DeployMethod = os.Getenv("DEPLOY_METHOD")
+	DeployPath = os.Getenv("DEPLOY_PATH")
+	if bk := os.Getenv("BUILD_KEEP"); bk != "" {
+		if val, err := strconv.Atoi(bk); err == nil && val > 0 {
+			BuildKeep = val
+		}
+	}
+
 	ArticleMediaDir = getEnv("ARTICLE_MEDIA_DIR", "")
 	StaticMediaDir = getEnv("STATIC_MEDIA_DIR", "")
 
@@ -66,22 +142,109 @@ func Init() {
 	GitUserName = getEnv("GIT_USER_NAME", "Hugo CMS Bot")
 	GitBranch = getEnv("GIT_BRANCH", "main")
 	GitRemote = getEnv("GIT_REMOTE", "origin")
+	GitMirrorRemotes = nil
+	for _, remote := range strings.Split(os.Getenv("GIT_MIRROR_REMOTES"), ",") {
+		if remote = strings.TrimSpace(remote); remote != "" && remote != GitRemote {
+			GitMirrorRemotes = append(GitMirrorRemotes, remote)
+		}
+	}
+	GitBotRole = getEnv("GIT_BOT_ROLE", "committer")
+	GitBackend = getEnv("GIT_BACKEND", "exec")
+
+	PublishMode = getEnv("PUBLISH_MODE", "simple")
+	GitHubAPIURL = strings.TrimSuffix(getEnv("GITHUB_API_URL", "https://api.github.com"), "/")
+
+	if qs := os.Getenv("GIT_QUEUE_SIZE"); qs != "" {
+		if val, err := strconv.Atoi(qs); err == nil && val > 0 {
+			GitQueueSize = val
+		}
+	}
+
+	if pr := os.Getenv("PUSH_RETRIES"); pr != "" {
+		if val, err := strconv.Atoi(pr); err == nil && val >= 0 {
+			PushRetries = val
+		}
+	}
+
+	GitSyncToken = os.Getenv("GIT_SYNC_TOKEN")
+	GitHubWebhookSecret = os.Getenv("GITHUB_WEBHOOK_SECRET")
+
+	GitAuthMode = getEnv("GIT_AUTH_MODE", "oauth")
+	GitHubAppID = os.Getenv("GITHUB_APP_ID")
+	GitHubAppInstallationID = os.Getenv("GITHUB_APP_INSTALLATION_ID")
+	GitHubAppPrivateKeyPath = os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH")
+	GitDeployKeyPath = os.Getenv("GIT_DEPLOY_KEY_PATH")
+	GitSSHKnownHosts = os.Getenv("GIT_SSH_KNOWN_HOSTS")
+	if si := os.Getenv("AUTO_SYNC_INTERVAL"); si != "" {
+		if val, err := time.ParseDuration(si); err == nil && val >= 0 {
+			AutoSyncInterval = val
+		} else {
+			fmt.Printf("Invalid AUTO_SYNC_INTERVAL %q, background sync disabled\n", si)
+		}
+	}
+
+	if dp := os.Getenv("DRAFT_PREVIEW_PORT"); dp != "" {
+		if val, err := strconv.Atoi(dp); err == nil && val > 0 {
+			DraftPreviewPort = val
+		}
+	}
+	if dm := os.Getenv("DRAFT_PREVIEW_MAX"); dm != "" {
+		if val, err := strconv.Atoi(dm); err == nil && val >= 0 {
+			DraftPreviewMax = val
+		}
+	}
+	if di := os.Getenv("DRAFT_PREVIEW_IDLE"); di != "" {
+		if val, err := time.ParseDuration(di); err == nil && val > 0 {
+			DraftPreviewIdle = val
+		}
+	}
+
+	if ll := os.Getenv("HUGO_LOG_LINES"); ll != "" {
+		if val, err := strconv.Atoi(ll); err == nil && val > 0 {
+			HugoLogLines = val
+		}
+	}
 
 	if cc := os.Getenv("CACHE_CONCURRENCY"); cc != "" {
 		if val, err := strconv.Atoi(cc); err == nil {
 			CacheConcurrency = val
 		}
 	}
+	FileWatcher = os.Getenv("FILE_WATCHER") != "false"
+	if wd := os.Getenv("WATCH_DEBOUNCE"); wd != "" {
+		if val, err := time.ParseDuration(wd); err == nil && val > 0 {
+			WatchDebounce = val
+		}
+	}
+
+	// Login only identifies editors unless their tokens touch the repository:
+	// in oauth mode, and for the editorial workflow's pull requests with a
+	// deploy key (which can't call the API) when no GIT_SYNC_TOKEN is set
+	scopes := []string{"read:user", "user:email"}
+	switch GitAuthMode {
+	case "github_app":
+	case "deploy_key":
+		if EditorialWorkflow() && GitSyncToken == "" {
+			scopes = []string{"repo", "user:email"}
+		}
+	default:
+		scopes = []string{"repo", "user:email"}
+	}
 
 	OauthConf = &oauth2.Config{
 		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-		Scopes:       []string{"repo"},
+		Scopes:       scopes,
 		Endpoint:     github.Endpoint,
 		RedirectURL:  redirectURL,
 	}
 }
 
+// EditorialWorkflow reports whether saves should go to per-article draft branches.
+func EditorialWorkflow() bool {
+	return PublishMode == "editorial_workflow"
+}
+
 func GetAppURL() string {
 	appURL := os.Getenv("APP_URL")
 	if appURL == "" {
@@ -1,24 +1,22 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"hugo-cms/pkg/config"
 	"hugo-cms/pkg/models"
 	"hugo-cms/pkg/services"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-func HandleBuild(c *gin.Context) {
-	// With Hugo Server running, explicit build is not needed for preview.
-	// We just return OK so frontend logic continues.
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "log": "Preview managed by Hugo Server"})
-}
-
 func HandleSync(c *gin.Context) {
 	session := sessions.Default(c)
 	token, ok := session.Get("access_token").(string)
@@ -26,8 +24,13 @@ func HandleSync(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
 		return
 	}
-	log, err := services.SyncRepo(token)
+	log, err := services.SyncRepo(token, sessionUser(c))
 
+	var conflictErr *services.MergeConflictError
+	if errors.As(err, &conflictErr) {
+		c.JSON(http.StatusConflict, gin.H{"status": "conflict", "files": conflictErr.Files, "log": log})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "log": log})
 		return
@@ -42,37 +45,146 @@ func HandlePublish(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
 		return
 	}
+	// Committing straight to the branch would bypass review
+	if config.EditorialWorkflow() {
+		c.JSON(http.StatusConflict, gin.H{"status": "workflow", "log": "The editorial workflow publishes articles through pull requests: request a review instead"})
+		return
+	}
 
 	var req struct {
-		Path string `json:"path"`
+		Path    string   `json:"path"`  // Content-relative, single article
+		Paths   []string `json:"paths"` // Repo-relative, as listed by /api/changes
+		Message string   `json:"message"`
 	}
-	// Try to bind JSON. If it fails (e.g. empty body), we assume full publish (Path="")
+	// Try to bind JSON. If it fails (e.g. empty body), we assume full publish (no paths)
 	c.ShouldBindJSON(&req)
 
-	gitPath := ""
+	var gitPaths []string
 	if req.Path != "" {
 		// Convert content-relative path to repo-relative path
 		// e.g. "posts/abc.md" -> "content/posts/abc.md"
 		// We use Join to be OS agnostic, but git expects forward slashes.
-		// git.go's PublishChanges might need to handle ToSlash, but let's do it here.
-		gitPath = filepath.ToSlash(filepath.Join("content", req.Path))
+		gitPaths = append(gitPaths, filepath.ToSlash(filepath.Join("content", req.Path)))
+	}
+	for _, p := range req.Paths {
+		p = filepath.ToSlash(p)
+		if strings.Contains(p, "..") || !(strings.HasPrefix(p, "content/") || strings.HasPrefix(p, "static/")) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path: " + p})
+			return
+		}
+		gitPaths = append(gitPaths, p)
+	}
+
+	result, err := services.PublishChanges(token, sessionUser(c), gitPaths, strings.TrimSpace(req.Message))
+	var conflictErr *services.MergeConflictError
+	switch {
+	case errors.Is(err, services.ErrPushConflict) || errors.As(err, &conflictErr):
+		c.JSON(http.StatusConflict, result)
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, result)
+	default:
+		c.JSON(http.StatusOK, result)
 	}
+}
 
-	log, err := services.PublishChanges(token, gitPath)
+func ListChanges(c *gin.Context) {
+	changes, err := services.ListChanges()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "log": log})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list changes: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "log": log})
+	c.JSON(http.StatusOK, changes)
 }
 
+// Largest page ListArticles returns
+const maxArticlePageSize = 500
+
+// ListArticles returns the articles matching the query parameters
+// collection, q, draft, dirty, tag, date_from and date_to, ordered by sort
+// (a front matter field, "-" prefixed for descending). With limit or cursor
+// it returns a page with the cursor of the next one; otherwise a plain
+// array of all matches.
 func ListArticles(c *gin.Context) {
-	articles, err := services.GetArticlesCache()
+	query, err := articleQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := services.QueryArticles(query)
+	if errors.Is(err, services.ErrInvalidCursor) || errors.Is(err, services.ErrUnknownCollection) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch articles"})
 		return
 	}
-	c.JSON(http.StatusOK, articles)
+
+	if c.Query("limit") == "" && query.Cursor == "" {
+		c.JSON(http.StatusOK, page.Articles)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func articleQuery(c *gin.Context) (services.ArticleQuery, error) {
+	query := services.ArticleQuery{
+		Collection: c.Query("collection"),
+		Text:       strings.TrimSpace(c.Query("q")),
+		Tag:        c.Query("tag"),
+		Sort:       c.Query("sort"),
+		Cursor:     c.Query("cursor"),
+	}
+
+	for name, target := range map[string]**bool{"draft": &query.Draft, "dirty": &query.Dirty} {
+		if v := c.Query(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*target = &b
+		}
+	}
+
+	var err error
+	if query.DateFrom, err = queryDate(c, "date_from", false); err != nil {
+		return query, err
+	}
+	if query.DateTo, err = queryDate(c, "date_to", true); err != nil {
+		return query, err
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("invalid limit: %q", v)
+		}
+		query.Limit = min(limit, maxArticlePageSize)
+	} else if query.Cursor != "" {
+		query.Limit = maxArticlePageSize
+	}
+	return query, nil
+}
+
+// queryDate parses an RFC 3339 time or a date. A date as upper bound
+// (endOfDay) includes the whole day.
+func queryDate(c *gin.Context, name string, endOfDay bool) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %q (use YYYY-MM-DD or RFC 3339)", name, v)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
 }
 
 func GetArticle(c *gin.Context) {
@@ -98,6 +210,30 @@ func GetArticle(c *gin.Context) {
 	})
 }
 
+// GetArticlePreviewURL returns where the preview server renders an article.
+func GetArticlePreviewURL(c *gin.Context) {
+	preview, err := services.ResolvePreviewURL(c.Query("path"))
+	switch {
+	case errors.Is(err, services.ErrNotRendered):
+		c.JSON(http.StatusNotFound, gin.H{"error": "This page is not rendered by Hugo (headless or build.render: never)"})
+	case os.IsNotExist(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, preview)
+	}
+}
+
+// articleContent returns the file content of an article posted by the
+// editor, either as front matter and body or as raw content.
+func articleContent(art models.Article) ([]byte, error) {
+	if art.FrontMatter != nil {
+		return services.ConstructFileContent(art.FrontMatter, art.Body, art.Format)
+	}
+	return []byte(art.Content), nil
+}
+
 func SaveArticle(c *gin.Context) {
 	var art models.Article
 	if err := c.BindJSON(&art); err != nil {
@@ -106,17 +242,10 @@ func SaveArticle(c *gin.Context) {
 	}
 
 	fullPath := services.SafeJoin(config.RepoPath, "content", art.Path)
-	var finalContent []byte
-	var err error
-
-	if art.FrontMatter != nil {
-		finalContent, err = services.ConstructFileContent(art.FrontMatter, art.Body, art.Format)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to construct file content: " + err.Error()})
-			return
-		}
-	} else {
-		finalContent = []byte(art.Content)
+	finalContent, err := articleContent(art)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to construct file content: " + err.Error()})
+		return
 	}
 
 	if err := os.WriteFile(fullPath, finalContent, 0644); err != nil {
@@ -125,9 +254,26 @@ func SaveArticle(c *gin.Context) {
 	}
 
 	services.UpdateCache(art.Path)
+	if !updateWorkflowBranch(c, art.Path, "Saved") {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "saved"})
 }
 
+// updateWorkflowBranch records the on-disk state of an article on its
+// cms/<slug> branch in the editorial workflow. done says what already
+// succeeded, for the error answered when the branch can't be updated.
+func updateWorkflowBranch(c *gin.Context, relPath, done string) bool {
+	if !config.EditorialWorkflow() {
+		return true
+	}
+	if err := services.SaveToWorkflowBranch(relPath, sessionUser(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": done + ", but failed to update draft branch: " + err.Error()})
+		return false
+	}
+	return true
+}
+
 func CreateArticle(c *gin.Context) {
 	var req struct {
 		Path       string                 `json:"path"`
@@ -223,6 +369,9 @@ func CreateArticle(c *gin.Context) {
 		contentRelPath = filepath.ToSlash(contentRelPath)
 
 		services.UpdateCache(contentRelPath)
+		if !updateWorkflowBranch(c, contentRelPath, "Created") {
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"status": "created", "path": contentRelPath})
 		return
 	}
@@ -244,6 +393,9 @@ func CreateArticle(c *gin.Context) {
 	}
 
 	services.UpdateCache(req.Path)
+	if !updateWorkflowBranch(c, req.Path, "Created") {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "created", "log": log})
 }
 
@@ -279,34 +431,8 @@ func GetDiff(c *gin.Context) {
 
 	newContent = services.NormalizeContent(newContent, collection)
 
-	tmpDir := os.TempDir()
-	f1, err := os.CreateTemp(tmpDir, "diff_old_*")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp file"})
-		return
-	}
-	defer os.Remove(f1.Name())
-
-	f2, err := os.CreateTemp(tmpDir, "diff_new_*")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp file"})
-		return
-	}
-	defer os.Remove(f2.Name())
-
-	if _, err := f1.Write(currentContent); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write temp file"})
-		return
-	}
-	if _, err := f2.Write(newContent); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write temp file"})
-		return
-	}
-	f1.Close()
-	f2.Close()
-
 	relPath := filepath.Join("content", art.Path)
-	diffStr, diffType := services.Diff(f1.Name(), f2.Name(), relPath)
+	diffStr, diffType := services.Diff(currentContent, newContent, relPath)
 
 	c.JSON(http.StatusOK, gin.H{"diff": diffStr, "type": diffType})
 }
@@ -333,6 +459,9 @@ func DeleteArticle(c *gin.Context) {
 	// Re-scan or remove from cache
 	// Assuming UpdateCache handles re-scan or we'll fix it
 	services.UpdateCache(req.Path)
+	if !updateWorkflowBranch(c, req.Path, "Deleted") {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"hugo-cms/pkg/services"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -70,6 +73,16 @@ func AuthCallback(c *gin.Context) {
 	}
 
 	session.Set("access_token", token.AccessToken)
+
+	// Remember who is editing so commits can be attributed to them.
+	// A failure here is not fatal; commits then fall back to the bot identity.
+	if user, err := services.NewGitHubClient(token.AccessToken).GetAuthenticatedUser(); err == nil {
+		session.Set("user_login", user.Login)
+		session.Set("user_name", user.Name)
+		session.Set("user_email", user.Email)
+	} else {
+		fmt.Printf("[Auth] Warning: failed to fetch GitHub profile: %v\n", err)
+	}
 	session.Save()
 
 	c.Redirect(http.StatusFound, "/")
@@ -81,3 +94,22 @@ func Logout(c *gin.Context) {
 	session.Save()
 	c.Redirect(http.StatusFound, "/login")
 }
+
+// sessionToken returns the GitHub access token of the logged-in user.
+func sessionToken(c *gin.Context) (string, bool) {
+	session := sessions.Default(c)
+	token, ok := session.Get("access_token").(string)
+	return token, ok
+}
+
+// sessionUser returns the GitHub identity stored at login, or nil if unknown.
+func sessionUser(c *gin.Context) *models.GitUser {
+	session := sessions.Default(c)
+	email, _ := session.Get("user_email").(string)
+	if email == "" {
+		return nil
+	}
+	login, _ := session.Get("user_login").(string)
+	name, _ := session.Get("user_name").(string)
+	return &models.GitUser{Login: login, Name: name, Email: email}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"hugo-cms/pkg/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleBuild queues a production build (and deploy, if configured). The
+// preview doesn't need it; hugo server renders that on its own.
+func HandleBuild(c *gin.Context) {
+	job := services.StartBuild(sessionUser(c))
+	c.JSON(http.StatusAccepted, job)
+}
+
+func ListBuilds(c *gin.Context) {
+	c.JSON(http.StatusOK, services.ListBuilds())
+}
+
+func GetBuild(c *gin.Context) {
+	job, err := services.GetBuild(c.Param("id"))
+	if errors.Is(err, services.ErrBuildNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"hugo-cms/pkg/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BlockDuringMerge rejects requests that would modify the working tree while
+// a sync is paused on merge conflicts.
+func BlockDuringMerge(c *gin.Context) {
+	if services.IsMerging() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Sync is waiting for conflict resolution", "status": "conflict"})
+		return
+	}
+	c.Next()
+}
+
+func ListConflicts(c *gin.Context) {
+	conflicts, err := services.ListConflicts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list conflicts: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"merging": services.IsMerging(), "conflicts": conflicts})
+}
+
+func ResolveConflict(c *gin.Context) {
+	var req struct {
+		Path        string                 `json:"path"` // Repo-relative
+		Resolution  string                 `json:"resolution"`
+		Content     string                 `json:"content"`
+		FrontMatter map[string]interface{} `json:"frontmatter"`
+		Body        string                 `json:"body"`
+		Format      string                 `json:"format"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if req.Path == "" || strings.Contains(req.Path, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	var content []byte
+	if req.Resolution == services.ResolveManual {
+		if req.FrontMatter != nil {
+			var err error
+			content, err = services.ConstructFileContent(req.FrontMatter, req.Body, req.Format)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to construct file content: " + err.Error()})
+				return
+			}
+		} else {
+			content = []byte(req.Content)
+		}
+	}
+
+	completed, err := services.ResolveConflict(req.Path, req.Resolution, content, sessionUser(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "resolved", "merge_completed": completed})
+}
+
+func AbortMerge(c *gin.Context) {
+	if err := services.AbortMerge(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "aborted"})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"hugo-cms/pkg/services"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func DiscardChanges(c *gin.Context) {
+	var req struct {
+		Path   string   `json:"path"`  // Content-relative article (whole bundle for index.md)
+		Paths  []string `json:"paths"` // Repo-relative files, e.g. media from /api/changes
+		DryRun bool     `json:"dry_run"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	var targets []string
+	if req.Path != "" {
+		if strings.Contains(req.Path, "..") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+			return
+		}
+		targets = append(targets, services.DiscardTarget(req.Path))
+	}
+	for _, p := range req.Paths {
+		targets = append(targets, filepath.ToSlash(p))
+	}
+
+	discarded, err := services.DiscardChanges(targets, req.DryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Discard failed: " + err.Error()})
+		return
+	}
+	if req.Path != "" && !req.DryRun && !updateWorkflowBranch(c, req.Path, "Discarded") {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "dry_run": req.DryRun, "files": discarded})
+}
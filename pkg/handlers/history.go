@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"hugo-cms/pkg/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetArticleHistory(c *gin.Context) {
+	targetPath := c.Query("path")
+	if targetPath == "" || strings.Contains(targetPath, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	history, err := services.ArticleHistory(targetPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read history: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func GetArticleRevision(c *gin.Context) {
+	targetPath := c.Query("path")
+	sha := c.Query("sha")
+	if targetPath == "" || strings.Contains(targetPath, "..") || sha == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path or revision"})
+		return
+	}
+
+	article, err := services.ArticleRevision(targetPath, sha)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, article)
+}
+
+func RestoreArticle(c *gin.Context) {
+	var req struct {
+		Path string `json:"path"`
+		SHA  string `json:"sha"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if req.Path == "" || strings.Contains(req.Path, "..") || req.SHA == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path or revision"})
+		return
+	}
+
+	if err := services.RestoreRevision(req.Path, req.SHA); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Restore failed: " + err.Error()})
+		return
+	}
+
+	services.UpdateCache(req.Path)
+	if !updateWorkflowBranch(c, req.Path, "Restored") {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "restored"})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/models"
+	"hugo-cms/pkg/services"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+func GetPreviewStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, services.HugoServerStatus())
+}
+
+func RestartPreview(c *gin.Context) {
+	if err := services.RestartHugoServer(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "restarting"})
+}
+
+// StreamHugoEvents streams hugo server and build output as Server-Sent
+// Events, named by event type (log, error, warn, build_start, build_done).
+func StreamHugoEvents(c *gin.Context) {
+	events, unsubscribe := services.SubscribeHugoEvents()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	// Send headers right away; the first event may take a while
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// Comments keep idle connections from being closed by proxies
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(ev.Type, ev)
+			return true
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		}
+	})
+}
+
+// StreamFileEvents streams changes below content/ and static/ made outside
+// the editor as Server-Sent "change" events.
+func StreamFileEvents(c *gin.Context) {
+	events, unsubscribe := services.SubscribeFileEvents()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("change", ev)
+			return true
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		}
+	})
+}
+
+// draftPreviewID returns the draft preview id of the editor's session,
+// creating one if create is set.
+func draftPreviewID(c *gin.Context, create bool) string {
+	session := sessions.Default(c)
+	id, _ := session.Get("draft_preview_id").(string)
+	if id == "" && create {
+		id = services.NewDraftPreviewID()
+		session.Set("draft_preview_id", id)
+		session.Save()
+	}
+	return id
+}
+
+// GetDraftPreviewStatus tells the editor whether unsaved content can be
+// previewed, in which case it doesn't autosave.
+func GetDraftPreviewStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": services.DraftPreviewsEnabled()})
+}
+
+// UpdateDraftPreview renders unsaved editor content in the session's draft
+// preview and returns its URL. The working tree is not touched.
+func UpdateDraftPreview(c *gin.Context) {
+	var art models.Article
+	if err := c.BindJSON(&art); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if art.Path == "" || strings.Contains(art.Path, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+	content, err := articleContent(art)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to construct file content: " + err.Error()})
+		return
+	}
+
+	preview, err := services.UpdateDraftPreview(draftPreviewID(c, true), art.Path, content)
+	switch {
+	case errors.Is(err, services.ErrDraftPreviewDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft previews are disabled"})
+	case errors.Is(err, services.ErrNotRendered):
+		c.JSON(http.StatusNotFound, gin.H{"error": "This page is not rendered by Hugo (headless or build.render: never)"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, preview)
+	}
+}
+
+func DiscardDraftPreview(c *gin.Context) {
+	if id := draftPreviewID(c, false); id != "" {
+		services.DiscardDraftPreview(id)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "discarded"})
+}
+
+// ProxyDraftPreview serves a draft preview to the session it belongs to.
+func ProxyDraftPreview(c *gin.Context) {
+	id := c.Param("session")
+	if id == "" || id != draftPreviewID(c, false) {
+		c.String(http.StatusNotFound, "Draft preview not found")
+		return
+	}
+	handler, ok := services.DraftPreviewHandler(id)
+	if !ok {
+		c.String(http.StatusNotFound, "Draft preview expired, open the preview again")
+		return
+	}
+	handler.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"hugo-cms/pkg/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireGitBinary rejects requests for features built on git plumbing with
+// 501 Not Implemented when GIT_BACKEND=gogit runs without a git binary.
+func RequireGitBinary(c *gin.Context) {
+	if !services.GitBinaryAvailable() {
+		c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"error": services.ErrGitUnavailable.Error(), "status": "unavailable"})
+		return
+	}
+	c.Next()
+}
+
+// Serialize runs the rest of the handler chain inside the repository queue.
+// A full queue answers 423 Locked; an exclusive operation that is already
+// queued answers 409 Conflict, while one that is running only delays it.
+func Serialize(name string, exclusive bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The handler chain runs on the queue worker while this goroutine
+		// waits, so the context is never used concurrently.
+		err := services.Repo.Run(name, exclusive, func() error {
+			c.Next()
+			return nil
+		})
+
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrRepoBusy):
+			c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": err.Error(), "status": "busy"})
+		case errors.Is(err, services.ErrOperationPending):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "status": "pending"})
+		default:
+			if !c.Writer.Written() {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+		}
+	}
+}
+
+func GetGitStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, services.Repo.Status())
+}
+
+func GetRemoteStatus(c *gin.Context) {
+	token := ""
+	if c.Query("fetch") != "" {
+		var ok bool
+		if token, ok = sessionToken(c); !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
+			return
+		}
+	}
+
+	status, err := services.GetRemoteStatus(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func PushPending(c *gin.Context) {
+	token, ok := sessionToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
+		return
+	}
+
+	result, err := services.PushPending(token, sessionUser(c))
+	var conflictErr *services.MergeConflictError
+	switch {
+	case errors.Is(err, services.ErrPushConflict) || errors.As(err, &conflictErr):
+		c.JSON(http.StatusConflict, result)
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, result)
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"hugo-cms/pkg/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Search returns the articles matching q, best first, with a highlighted
+// snippet of the best matching field. limit defaults to 20 (at most 100).
+func Search(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing query"})
+		return
+	}
+	limit := services.DefaultSearchLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(n, services.MaxSearchLimit)
+	}
+
+	result, err := services.SearchArticles(query, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
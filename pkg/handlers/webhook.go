@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/services"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GitHub caps webhook payloads at 25 MB
+const maxWebhookPayload = 25 << 20
+
+// GitHubWebhook handles push events from GitHub. Requests are authenticated by
+// their HMAC signature instead of a session; pushes to config.GitBranch queue
+// a sync with the server credential and the handler answers without waiting.
+func GitHubWebhook(c *gin.Context) {
+	if config.GitHubWebhookSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook is not configured"})
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookPayload))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read payload"})
+		return
+	}
+	if !services.VerifyWebhookSignature(payload, c.GetHeader("X-Hub-Signature-256")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	deliveryID := c.GetHeader("X-GitHub-Delivery")
+	switch event := c.GetHeader("X-GitHub-Event"); event {
+	case "ping":
+		c.JSON(http.StatusOK, gin.H{"status": "pong"})
+		return
+	case "push":
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "ignored", "reason": "event " + event})
+		return
+	}
+
+	var push struct {
+		Ref   string `json:"ref"`
+		After string `json:"after"`
+	}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid push payload"})
+		return
+	}
+	if push.Ref != "refs/heads/"+config.GitBranch {
+		c.JSON(http.StatusOK, gin.H{"status": "ignored", "reason": "ref " + push.Ref})
+		return
+	}
+	if !services.RecordDelivery(deliveryID) {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+
+	fmt.Printf("[Webhook] Delivery %s: push to %s (%s), syncing\n", deliveryID, push.Ref, push.After)
+	go func() {
+		if err := services.SyncFromWebhook(deliveryID); err != nil {
+			fmt.Printf("[Webhook] Delivery %s: sync failed: %v\n", deliveryID, err)
+		}
+	}()
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued"})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/services"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(event, delivery, payload, signature string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/hooks/github", GitHubWebhook)
+	req := httptest.NewRequest(http.MethodPost, "/hooks/github", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// setupRepos points config.RepoPath at a clone of a local bare repository
+// and returns a second clone to push from.
+func setupRepos(t *testing.T) string {
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(key, "Test")
+	}
+	for _, key := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(key, "test@example.com")
+	}
+	root := t.TempDir()
+	origin, work, other := filepath.Join(root, "origin.git"), filepath.Join(root, "work"), filepath.Join(root, "other")
+
+	runGit(t, root, "init", "--quiet", "--bare", "-b", "main", origin)
+	runGit(t, root, "clone", "--quiet", origin, work)
+	if err := os.MkdirAll(filepath.Join(work, "content"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "content", "hello.md"), []byte("---\ntitle: Hello\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "--quiet", "-m", "init")
+	runGit(t, work, "push", "--quiet", "origin", "HEAD:main")
+	runGit(t, root, "clone", "--quiet", origin, other)
+
+	repoPath, branch, remote := config.RepoPath, config.GitBranch, config.GitRemote
+	t.Cleanup(func() { config.RepoPath, config.GitBranch, config.GitRemote = repoPath, branch, remote })
+	config.RepoPath, config.GitBranch, config.GitRemote = work, "main", "origin"
+	return other
+}
+
+func setWebhookSecret(t *testing.T, secret string) {
+	previous := config.GitHubWebhookSecret
+	t.Cleanup(func() { config.GitHubWebhookSecret = previous })
+	config.GitHubWebhookSecret = secret
+}
+
+func TestGitHubWebhookRejectsRequests(t *testing.T) {
+	push := `{"ref":"refs/heads/main","after":"abc"}`
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		status    int
+	}{
+		{"not configured", "", sign(push), http.StatusNotFound},
+		{"missing signature", testWebhookSecret, "", http.StatusUnauthorized},
+		{"wrong secret", "other-secret", sign(push), http.StatusUnauthorized},
+		{"not sha256", testWebhookSecret, "sha1=" + strings.TrimPrefix(sign(push), "sha256="), http.StatusUnauthorized},
+		{"not hex", testWebhookSecret, "sha256=zz", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setWebhookSecret(t, tt.secret)
+			if w := postWebhook("push", "reject-"+tt.name, push, tt.signature); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestGitHubWebhookIgnoredEvents(t *testing.T) {
+	setWebhookSecret(t, testWebhookSecret)
+	branch := config.GitBranch
+	t.Cleanup(func() { config.GitBranch = branch })
+	config.GitBranch = "main"
+
+	tests := []struct {
+		name    string
+		event   string
+		payload string
+		status  int
+		result  string
+	}{
+		{"ping", "ping", `{"zen":"Keep it simple."}`, http.StatusOK, "pong"},
+		{"other event", "issues", `{"action":"opened"}`, http.StatusOK, "ignored"},
+		{"other branch", "push", `{"ref":"refs/heads/feature","after":"abc"}`, http.StatusOK, "ignored"},
+		{"tag", "push", `{"ref":"refs/tags/v1.0","after":"abc"}`, http.StatusOK, "ignored"},
+		{"invalid payload", "push", `{"ref":`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postWebhook(tt.event, "ignored-"+tt.name, tt.payload, sign(tt.payload))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body struct {
+				Status string `json:"status"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Status != tt.result {
+				t.Errorf("status = %q, want %q", body.Status, tt.result)
+			}
+		})
+	}
+}
+
+// A push during a running sync must not be dropped: the running sync may
+// have fetched before the push landed.
+func TestGitHubWebhookSyncsAfterRunningSync(t *testing.T) {
+	other := setupRepos(t)
+	setWebhookSecret(t, testWebhookSecret)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	defer unblock()
+	go services.Repo.Run("sync", true, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	if err := os.WriteFile(filepath.Join(other, "content", "new.md"), []byte("---\ntitle: New\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, other, "add", ".")
+	runGit(t, other, "commit", "--quiet", "-m", "new article")
+	runGit(t, other, "push", "--quiet", "origin", "HEAD:main")
+	head := runGit(t, other, "rev-parse", "HEAD")
+
+	payload := `{"ref":"refs/heads/main","after":"` + head + `"}`
+	delivery := "running-sync-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	w := postWebhook("push", delivery, payload, sign(payload))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	if w := postWebhook("push", delivery, payload, sign(payload)); !strings.Contains(w.Body.String(), "duplicate") {
+		t.Errorf("redelivery: %s, want duplicate", w.Body)
+	}
+	unblock()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for runGit(t, config.RepoPath, "rev-parse", "HEAD") != head {
+		if time.Now().After(deadline) {
+			t.Fatal("webhook sync did not pull the pushed commit")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"hugo-cms/pkg/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ListWorkflowEntries(c *gin.Context) {
+	token, ok := sessionToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
+		return
+	}
+
+	entries, err := services.ListWorkflowEntries(token, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list entries: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func PublishWorkflowEntry(c *gin.Context) {
+	token, ok := sessionToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.Path == "" || strings.Contains(req.Path, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	entry, log, err := services.PublishWorkflowEntry(token, req.Path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error(), "log": log})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "entry": entry, "log": log})
+}
+
+func UpdateWorkflowStatus(c *gin.Context) {
+	token, ok := sessionToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
+		return
+	}
+
+	var req struct {
+		Path   string `json:"path"`
+		Status string `json:"status"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.Path == "" || strings.Contains(req.Path, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	entry, err := services.UpdateWorkflowStatus(token, req.Path, req.Status)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "entry": entry})
+}
+
+func MergeWorkflowEntry(c *gin.Context) {
+	token, ok := sessionToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token"})
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.Path == "" || strings.Contains(req.Path, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
+		return
+	}
+
+	log, err := services.MergeWorkflowEntry(token, sessionUser(c), req.Path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error(), "log": log})
+		return
+	}
+	services.UpdateCache(req.Path)
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "log": log})
+}
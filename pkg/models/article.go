@@ -9,4 +9,45 @@ type Article struct {
 	Body        string                 `json:"body,omitempty"`
 	Format      string                 `json:"format,omitempty"` // yaml, toml, json
 	IsDirty     bool                   `json:"is_dirty"`
+	IsUnpushed  bool                   `json:"is_unpushed"` // Committed locally but not pushed
+
+	// Front matter kept by the article cache for filtering and sorting
+	Date       string                 `json:"date,omitempty"` // RFC 3339, UTC
+	Lastmod    string                 `json:"lastmod,omitempty"`
+	Draft      bool                   `json:"draft,omitempty"`
+	Weight     int                    `json:"weight,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	Categories []string               `json:"categories,omitempty"`
+	Params     map[string]interface{} `json:"-"` // Scalar fields, lowercased keys
+}
+
+// ArticlePage is one page of a filtered article list.
+type ArticlePage struct {
+	Articles   []Article `json:"articles"`
+	Total      int       `json:"total"` // Matches across all pages
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// PreviewURL is where the preview server renders an article.
+type PreviewURL struct {
+	Path     string   `json:"path"` // Permalink relative to the site root
+	URL      string   `json:"url"`  // Path below the preview proxy
+	Kind     string   `json:"kind"` // home, section or page
+	Language string   `json:"language,omitempty"`
+	Aliases  []string `json:"aliases,omitempty"`
+}
+
+// SearchHit is an article matching a full-text search.
+type SearchHit struct {
+	Path    string  `json:"path"`
+	Title   string  `json:"title"`
+	Field   string  `json:"field"`   // Best matching field: title, body or a front matter key
+	Snippet string  `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+	Score   float64 `json:"score"`
+}
+
+type SearchResult struct {
+	Query string      `json:"query"`
+	Total int         `json:"total"`
+	Hits  []SearchHit `json:"hits"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// BuildJob is one production build of the site and its deploy.
+type BuildJob struct {
+	ID          string    `json:"id"`
+	Status      string    `json:"status"` // queued, running, succeeded, failed
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Revision    string    `json:"revision,omitempty"` // The commit built, without uncommitted edits
+	CreatedAt   time.Time `json:"created_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Duration    string    `json:"duration,omitempty"`
+	Deploy      string    `json:"deploy,omitempty"` // Deploy method, empty if not deployed
+	Error       string    `json:"error,omitempty"`
+	Log         string    `json:"log,omitempty"` // Only in GET /api/builds/:id
+}
@@ -0,0 +1,15 @@
+package models
+
+// Change is a dirty file in the working tree, relative to the repo root.
+type Change struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"` // Set for renames
+	Type    string `json:"type"`               // added, modified, deleted, renamed
+	Kind    string `json:"kind"`               // content, media
+}
+
+// DiscardedFile is a file reset (or removed) by a discard request.
+type DiscardedFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // restored, removed
+}
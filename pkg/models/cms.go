@@ -1,11 +1,28 @@
 package models
 
 type CMSConfig struct {
+	Backend      Backend      `yaml:"backend"`
 	MediaFolder  string       `yaml:"media_folder"`
 	PublicFolder string       `yaml:"public_folder"`
 	Collections  []Collection `yaml:"collections"`
 }
 
+type Backend struct {
+	Name           string         `yaml:"name"`
+	Branch         string         `yaml:"branch"`
+	CommitMessages CommitMessages `yaml:"commit_messages"`
+}
+
+// CommitMessages are commit message templates, using the same keys and
+// placeholders ({{slug}}, {{path}}, {{collection}}, {{author-login}}, ...) as Decap CMS.
+type CommitMessages struct {
+	Create      string `yaml:"create"`
+	Update      string `yaml:"update"`
+	Delete      string `yaml:"delete"`
+	UploadMedia string `yaml:"uploadMedia"`
+	DeleteMedia string `yaml:"deleteMedia"`
+}
+
 type Collection struct {
 	Name         string  `yaml:"name"`
 	Label        string  `yaml:"label"`
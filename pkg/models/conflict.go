@@ -0,0 +1,19 @@
+package models
+
+// Conflict describes an unmerged file left behind by a sync.
+type Conflict struct {
+	Path   string          `json:"path"` // Repo-relative
+	Base   ConflictVersion `json:"base"`
+	Ours   ConflictVersion `json:"ours"`
+	Theirs ConflictVersion `json:"theirs"`
+}
+
+// ConflictVersion is one side of a conflict. Content files have their front
+// matter and body parsed separately; other files only carry raw content.
+type ConflictVersion struct {
+	Exists      bool                   `json:"exists"`
+	Content     string                 `json:"content,omitempty"`
+	FrontMatter map[string]interface{} `json:"frontmatter,omitempty"`
+	Body        string                 `json:"body,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+}
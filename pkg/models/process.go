@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// ProcessStatus describes a supervised background process such as hugo server.
+type ProcessStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"` // starting, running, unhealthy, backoff, stopped
+	Addr      string    `json:"addr"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Restarts  int       `json:"restarts"`
+	LastExit  string    `json:"last_exit,omitempty"`
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check"`
+	Logs      []string  `json:"logs"`
+}
+
+// HugoEvent is one line of hugo server or build output, streamed to editors.
+// Errors and warnings carry the position hugo reported, if any.
+type HugoEvent struct {
+	Type    string    `json:"type"`   // log, error, warn, build_start, build_done
+	Source  string    `json:"source"` // server or build
+	Message string    `json:"message"`
+	File    string    `json:"file,omitempty"` // As reported by hugo
+	Path    string    `json:"path,omitempty"` // Content-relative, when File is an article
+	Line    int       `json:"line,omitempty"`
+	Column  int       `json:"column,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// FileChange is a batch of files changed below content/ or static/ outside
+// the editor's control, streamed to editors. Paths are relative to the repo.
+type FileChange struct {
+	Changed []string  `json:"changed,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	Time    time.Time `json:"time"`
+}
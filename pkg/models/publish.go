@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// PublishResult is the structured outcome of a publish.
+type PublishResult struct {
+	Status    string            `json:"status"` // ok, conflict, error
+	Commit    string            `json:"commit,omitempty"`
+	Files     []string          `json:"files"`
+	Attempts  int               `json:"attempts"` // Push attempts made
+	Ahead     int               `json:"ahead"`    // Local commits not on the remote branch
+	Behind    int               `json:"behind"`   // Remote commits not merged locally
+	Conflicts []string          `json:"conflicts,omitempty"`
+	Mirrors   map[string]string `json:"mirrors,omitempty"` // Mirror remote -> "ok" or error
+	Log       string            `json:"log"`
+}
+
+// RemoteStatus compares the local branch with the remote branch.
+type RemoteStatus struct {
+	Remote   string           `json:"remote"`
+	Branch   string           `json:"branch"`
+	Ahead    int              `json:"ahead"`
+	Behind   int              `json:"behind"`
+	Unpushed []UnpushedCommit `json:"unpushed"`
+	AutoSync AutoSyncStatus   `json:"auto_sync"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// UnpushedCommit is a local commit that has not reached the remote yet.
+type UnpushedCommit struct {
+	Revision
+	Files []string `json:"files"`
+}
+
+// AutoSyncStatus is the state of the background sync.
+type AutoSyncStatus struct {
+	Enabled   bool      `json:"enabled"`
+	Interval  string    `json:"interval,omitempty"`
+	LastRun   time.Time `json:"last_run"`
+	Result    string    `json:"result,omitempty"` // up_to_date, fast_forwarded, behind, error
+	Behind    int       `json:"behind"`
+	Updated   []string  `json:"updated,omitempty"` // Files changed by the last fast-forward
+	LastError string    `json:"last_error,omitempty"`
+}
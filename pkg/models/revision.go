@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Revision is a single commit in the history of a content file.
+type Revision struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+	Path    string    `json:"path"` // Repo-relative path at this revision (follows renames)
+}
@@ -0,0 +1,16 @@
+package models
+
+// GitUser is the GitHub identity of the logged-in editor.
+type GitUser struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// DisplayName prefers the profile name and falls back to the login.
+func (u *GitUser) DisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Login
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// WorkflowEntry is an article living on its own cms/<slug> branch.
+type WorkflowEntry struct {
+	Slug      string    `json:"slug"`
+	Branch    string    `json:"branch"`
+	Path      string    `json:"path"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"` // draft, pending_review, pending_publish
+	UpdatedAt time.Time `json:"updated_at"`
+	PRNumber  int       `json:"pr_number,omitempty"`
+	PRURL     string    `json:"pr_url,omitempty"`
+}
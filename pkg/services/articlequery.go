@@ -0,0 +1,245 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/models"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrUnknownCollection = errors.New("unknown collection")
+)
+
+// ArticleQuery filters, sorts and pages the cached article list. Zero
+// values don't filter.
+type ArticleQuery struct {
+	Collection string // Name from the CMS config
+	Text       string // Case-insensitive substring of title or path
+	Draft      *bool
+	Dirty      *bool
+	Tag        string
+	DateFrom   time.Time
+	DateTo     time.Time // Inclusive
+	// Front matter field (or "path", "title") to sort by, descending when
+	// prefixed with "-"; articles without the field come last. Default "path".
+	Sort   string
+	Limit  int // 0 returns all matches
+	Cursor string
+}
+
+// articleCursor is the position after the last article of a page, so
+// articles added or removed in the meantime don't shift later pages.
+type articleCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v,omitempty"`
+	Path  string      `json:"p"`
+}
+
+// QueryArticles returns the cached articles matching q, sorted, starting
+// after q.Cursor and limited to q.Limit.
+func QueryArticles(q ArticleQuery) (models.ArticlePage, error) {
+	articles, err := GetArticlesCache()
+	if err != nil {
+		return models.ArticlePage{}, err
+	}
+
+	match, err := articleFilter(q)
+	if err != nil {
+		return models.ArticlePage{}, err
+	}
+	// The cache is shared; filter into a new slice before sorting
+	var matches []models.Article
+	for _, art := range articles {
+		if match(art) {
+			matches = append(matches, art)
+		}
+	}
+
+	if q.Sort == "" {
+		q.Sort = "path"
+	}
+	field, desc := strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+	field = strings.ToLower(field)
+	less := func(a, b models.Article) bool {
+		if c := compareSortValues(sortValue(a, field), sortValue(b, field), desc); c != 0 {
+			return c < 0
+		}
+		return filepath.ToSlash(a.Path) < filepath.ToSlash(b.Path)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return less(matches[i], matches[j]) })
+
+	page := models.ArticlePage{Total: len(matches), Articles: matches}
+	if q.Cursor != "" {
+		cursor, err := decodeArticleCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort {
+			return models.ArticlePage{}, ErrInvalidCursor
+		}
+		after := models.Article{Path: cursor.Path, Params: map[string]interface{}{field: cursor.Value}}
+		if field == "title" {
+			after.Title, _ = cursor.Value.(string)
+		}
+		start := sort.Search(len(matches), func(i int) bool { return less(after, matches[i]) })
+		page.Articles = matches[start:]
+	}
+	if q.Limit > 0 && len(page.Articles) > q.Limit {
+		page.Articles = page.Articles[:q.Limit]
+		last := page.Articles[len(page.Articles)-1]
+		page.NextCursor = encodeArticleCursor(articleCursor{
+			Sort:  q.Sort,
+			Value: sortValue(last, field),
+			Path:  filepath.ToSlash(last.Path),
+		})
+	}
+	if page.Articles == nil {
+		page.Articles = []models.Article{}
+	}
+	return page, nil
+}
+
+func articleFilter(q ArticleQuery) (func(models.Article) bool, error) {
+	folder := "" // Content-relative; "" is all of content/
+	if q.Collection != "" {
+		cfg, err := GetCMSConfig()
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, col := range cfg.Collections {
+			if col.Name == q.Collection {
+				folder = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(col.Folder)), "content")
+				folder = strings.Trim(folder, "/")
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCollection, q.Collection)
+		}
+	}
+	text := strings.ToLower(q.Text)
+
+	return func(art models.Article) bool {
+		path := filepath.ToSlash(art.Path)
+		if folder != "" && path != folder && !strings.HasPrefix(path, folder+"/") {
+			return false
+		}
+		if text != "" && !strings.Contains(strings.ToLower(art.Title), text) && !strings.Contains(strings.ToLower(path), text) {
+			return false
+		}
+		if q.Draft != nil && art.Draft != *q.Draft {
+			return false
+		}
+		if q.Dirty != nil && art.IsDirty != *q.Dirty {
+			return false
+		}
+		if q.Tag != "" && !containsFold(art.Tags, q.Tag) {
+			return false
+		}
+		if !q.DateFrom.IsZero() || !q.DateTo.IsZero() {
+			date, err := time.Parse(time.RFC3339, art.Date)
+			if err != nil {
+				return false
+			}
+			if !q.DateFrom.IsZero() && date.Before(q.DateFrom) {
+				return false
+			}
+			if !q.DateTo.IsZero() && date.After(q.DateTo) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortValue(art models.Article, field string) interface{} {
+	switch field {
+	case "path":
+		return filepath.ToSlash(art.Path)
+	case "title":
+		return art.Title
+	}
+	return art.Params[field]
+}
+
+// compareSortValues orders numbers, then booleans, then strings, with
+// missing values last in either direction.
+func compareSortValues(a, b interface{}, desc bool) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		default:
+			return -1
+		}
+	}
+	c := 0
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		switch {
+		case !ok:
+			c = -1
+		case av < bv:
+			c = -1
+		case av > bv:
+			c = 1
+		}
+	case bool:
+		switch bv := b.(type) {
+		case float64:
+			c = 1
+		case bool:
+			if av != bv {
+				c = 1
+				if !av {
+					c = -1
+				}
+			}
+		default:
+			c = -1
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			c = strings.Compare(strings.ToLower(av), strings.ToLower(bv))
+		} else {
+			c = 1
+		}
+	}
+	if desc {
+		c = -c
+	}
+	return c
+}
+
+func encodeArticleCursor(cursor articleCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeArticleCursor(s string) (articleCursor, error) {
+	var cursor articleCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Background sync results.
+const (
+	SyncUpToDate      = "up_to_date"
+	SyncFastForwarded = "fast_forwarded"
+	SyncBehind        = "behind"
+	SyncError         = "error"
+)
+
+var (
+	autoSyncMu     sync.Mutex
+	autoSyncStatus models.AutoSyncStatus
+)
+
+// StartAutoSync runs BackgroundSync every config.AutoSyncInterval.
+func StartAutoSync() {
+	if config.AutoSyncInterval <= 0 {
+		return
+	}
+
+	autoSyncMu.Lock()
+	autoSyncStatus.Enabled = true
+	autoSyncStatus.Interval = config.AutoSyncInterval.String()
+	autoSyncMu.Unlock()
+
+	fmt.Printf("[AutoSync] Fetching %s/%s every %v\n", config.GitRemote, config.GitBranch, config.AutoSyncInterval)
+	go func() {
+		ticker := time.NewTicker(config.AutoSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := BackgroundSync(); err != nil {
+				fmt.Printf("[AutoSync] %v\n", err)
+			}
+		}
+	}()
+}
+
+// GetAutoSyncStatus returns the outcome of the last background sync.
+func GetAutoSyncStatus() models.AutoSyncStatus {
+	autoSyncMu.Lock()
+	defer autoSyncMu.Unlock()
+	return autoSyncStatus
+}
+
+// BackgroundSync queues a fetch with the server credential. A clean working
+// tree that is only behind is fast-forwarded and the cache entries of the
+// changed articles are refreshed; otherwise the repo is just marked behind
+// until an editor syncs. A sync already queued makes this a no-op.
+func BackgroundSync() error {
+	err := Repo.Run("background-sync", true, func() error {
+		result, behind, updated, err := backgroundSync()
+
+		autoSyncMu.Lock()
+		defer autoSyncMu.Unlock()
+		autoSyncStatus.LastRun = time.Now()
+		autoSyncStatus.Result = result
+		autoSyncStatus.Behind = behind
+		autoSyncStatus.Updated = updated
+		autoSyncStatus.LastError = ""
+		if err != nil {
+			autoSyncStatus.LastError = err.Error()
+		}
+		return err
+	})
+	if errors.Is(err, ErrOperationPending) {
+		return nil
+	}
+	return err
+}
+
+func backgroundSync() (string, int, []string, error) {
+	if IsMerging() {
+		return SyncBehind, 0, nil, nil
+	}
+
+	if log, err := fetchUpstream(ServerToken()); err != nil {
+		return SyncError, 0, nil, fmt.Errorf("fetch failed: %w: %s", err, strings.TrimSpace(log))
+	}
+	ahead, behind, err := AheadBehind()
+	if err != nil {
+		return SyncError, 0, nil, err
+	}
+	if behind == 0 {
+		return SyncUpToDate, 0, nil, nil
+	}
+
+	// Only fast-forward when nothing local could be affected
+	dirty, err := GetGitBackend().Status()
+	if err != nil {
+		return SyncError, behind, nil, err
+	}
+	if ahead > 0 || len(dirty) > 0 {
+		fmt.Printf("[AutoSync] %d commit(s) behind, working tree not clean (ahead %d, %d changed file(s))\n", behind, ahead, len(dirty))
+		return SyncBehind, behind, nil, nil
+	}
+
+	oldHead, err := GetGitBackend().Head()
+	if err != nil {
+		return SyncError, behind, nil, err
+	}
+	if log, err := GetGitBackend().Pull(ServerToken(), nil); err != nil {
+		return SyncError, behind, nil, fmt.Errorf("fast-forward failed: %w: %s", err, strings.TrimSpace(log))
+	}
+
+	var updated []string
+	formats := currentContentFormats()
+	for file := range changedFiles(oldHead, "HEAD") {
+		updated = append(updated, file)
+		if formats.isContentPage(file) {
+			UpdateCache(filepath.FromSlash(strings.TrimPrefix(file, "content/")))
+		}
+	}
+	sort.Strings(updated)
+	fmt.Printf("[AutoSync] Fast-forwarded %d commit(s), %d file(s) changed\n", behind, len(updated))
+	return SyncFastForwarded, 0, updated, nil
+}
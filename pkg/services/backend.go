@@ -0,0 +1,237 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitBackend covers the git operations behind editing, status scans,
+// syncing and publishing. Features built on git plumbing (rebase on a
+// rejected push, merge conflict resolution, history, discard, editorial
+// workflow branches) always use the git binary and fail with
+// ErrGitUnavailable without it.
+type GitBackend interface {
+	// Status lists changed and untracked files below the repo-relative
+	// pathspecs, untracked files individually.
+	Status(pathspecs ...string) ([]StatusEntry, error)
+	// ShowHead returns the content of a repo-relative file at HEAD.
+	ShowHead(path string) ([]byte, error)
+	// Head returns the commit checked out.
+	Head() (string, error)
+	// ResolveRevision returns the commit a revision such as a ref points to.
+	ResolveRevision(rev string) (string, error)
+	// RevisionExists reports whether rev resolves, e.g. "MERGE_HEAD" or
+	// "HEAD:content/posts/a.md".
+	RevisionExists(rev string) bool
+	// RemoteURL returns the URL of a remote.
+	RemoteURL(remote string) (string, error)
+	// AheadBehind counts the commits on HEAD missing from ref (ahead) and
+	// the reverse (behind).
+	AheadBehind(ref string) (int, int, error)
+	// CommitsSince lists the commits on HEAD that are not on ref, newest
+	// first, with the files each one touches (none for merges).
+	CommitsSince(ref string) ([]models.UnpushedCommit, error)
+	// ChangedFiles lists the repo-relative files that differ between two commits.
+	ChangedFiles(from, to string) ([]string, error)
+	// Add stages the paths including deletions; "." stages everything.
+	Add(paths ...string) error
+	// Commit records the staged paths (the whole index when paths is empty)
+	// for author and returns a human readable log.
+	Commit(message string, author *models.GitUser, paths []string) (string, error)
+	// Fetch updates upstreamRef from config.GitRemote.
+	Fetch(token string) (string, error)
+	// Push pushes HEAD to config.GitBranch of a remote (config.GitRemote or
+	// a mirror) and updates upstreamRef for config.GitRemote.
+	Push(remote, token string) (string, error)
+	// Pull merges config.GitBranch from config.GitRemote into HEAD.
+	Pull(token string, author *models.GitUser) (string, error)
+}
+
+// StatusEntry is one path of a status scan, with porcelain status codes.
+type StatusEntry struct {
+	Path     string
+	OldPath  string // Source of a rename
+	Staging  byte
+	Worktree byte
+}
+
+// GetGitBackend returns the backend selected by config.GitBackend.
+func GetGitBackend() GitBackend {
+	if config.GitBackend == "gogit" {
+		return goGitBackend{}
+	}
+	return execBackend{}
+}
+
+// execBackend drives the git binary.
+type execBackend struct{}
+
+func (execBackend) Status(pathspecs ...string) ([]StatusEntry, error) {
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, pathspecs...)
+	out, err := runGit(readOnlyGitEnv, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []StatusEntry
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 4 {
+			continue
+		}
+		entry := StatusEntry{Path: field[3:], Staging: field[0], Worktree: field[1]}
+		if (entry.Staging == 'R' || entry.Staging == 'C') && i+1 < len(fields) {
+			// With -z the source of a rename follows as its own field
+			entry.OldPath = fields[i+1]
+			i++
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (execBackend) ShowHead(path string) ([]byte, error) {
+	out, err := runGit(nil, nil, "show", "HEAD:"+path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+func (execBackend) Head() (string, error) {
+	out, err := runGit(readOnlyGitEnv, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+func (execBackend) ResolveRevision(rev string) (string, error) {
+	out, err := runGit(readOnlyGitEnv, nil, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	return strings.TrimSpace(out), err
+}
+
+func (execBackend) RevisionExists(rev string) bool {
+	_, err := runGit(readOnlyGitEnv, nil, "rev-parse", "--verify", "--quiet", rev)
+	return err == nil
+}
+
+func (execBackend) RemoteURL(remote string) (string, error) {
+	out, err := runGit(readOnlyGitEnv, nil, "remote", "get-url", remote)
+	if err != nil {
+		return "", fmt.Errorf("failed to get url of remote %s: %w", remote, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (execBackend) AheadBehind(ref string) (int, int, error) {
+	out, err := runGit(readOnlyGitEnv, nil, "rev-list", "--left-right", "--count", "HEAD..."+ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	ahead, _ := strconv.Atoi(fields[0])
+	behind, _ := strconv.Atoi(fields[1])
+	return ahead, behind, nil
+}
+
+func (execBackend) CommitsSince(ref string) ([]models.UnpushedCommit, error) {
+	out, err := runGit(readOnlyGitEnv, nil, "log", "--name-only",
+		"--format=%x1e%H%x1f%an%x1f%ae%x1f%aI%x1f%s", ref+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []models.UnpushedCommit{}
+	for _, record := range strings.Split(out, "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		lines := strings.Split(record, "\n")
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+
+		commit := models.UnpushedCommit{Files: []string{}}
+		commit.SHA = fields[0]
+		commit.Author = fields[1]
+		commit.Email = fields[2]
+		commit.Date, _ = time.Parse(time.RFC3339, fields[3])
+		commit.Message = fields[4]
+		for _, file := range lines[1:] {
+			if file = strings.TrimSpace(file); file != "" {
+				commit.Files = append(commit.Files, file)
+			}
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+func (execBackend) ChangedFiles(from, to string) ([]string, error) {
+	out, err := runGit(readOnlyGitEnv, nil, "diff", "--name-only", from, to)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+func (execBackend) Add(paths ...string) error {
+	args := append([]string{"add", "-A", "--"}, paths...)
+	_, err := runGit(nil, nil, args...)
+	return err
+}
+
+func (execBackend) Commit(message string, author *models.GitUser, paths []string) (string, error) {
+	args := []string{"commit", "-m", message}
+	if len(paths) > 0 {
+		// Commit only the selection, even if something else was staged earlier
+		args = append(append(args, "--"), paths...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = config.RepoPath
+	// Identity is passed via environment so concurrent editors don't race on repo config
+	cmd.Env = append(os.Environ(), commitIdentityEnv(author)...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func (execBackend) Fetch(token string) (string, error) {
+	refspec := "+refs/heads/" + config.GitBranch + ":" + upstreamRef()
+	return ExecuteGitWithToken(config.RepoPath, token, "fetch", config.GitRemote, refspec)
+}
+
+func (execBackend) Push(remote, token string) (string, error) {
+	log, err := executeGitRemote(config.RepoPath, remote, token, nil, "push", remote, "HEAD:refs/heads/"+config.GitBranch)
+	if err == nil && remote == config.GitRemote {
+		runGit(nil, nil, "update-ref", upstreamRef(), "HEAD")
+	}
+	return log, err
+}
+
+// Pull fetches into upstreamRef and merges that, as `git pull <url> <branch>`
+// would leave the remote-tracking ref behind.
+func (e execBackend) Pull(token string, author *models.GitUser) (string, error) {
+	log, err := e.Fetch(token)
+	if err != nil {
+		return log, err
+	}
+	// The short name gives the usual "Merge remote-tracking branch 'origin/main'"
+	out, err := runGit(commitIdentityEnv(author), nil, "merge", "--no-edit", config.GitRemote+"/"+config.GitBranch)
+	return log + out, err
+}
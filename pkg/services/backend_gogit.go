@@ -0,0 +1,638 @@
+package services
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// goGitBackend implements GitBackend in pure Go, so the core editing and
+// publishing flow works without a git binary and status scans don't spawn
+// a process per file. Pull is fast-forward only.
+type goGitBackend struct{}
+
+func (goGitBackend) open() (*git.Repository, *git.Worktree, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, wt, nil
+}
+
+// auth returns the URL and credentials for a remote, following the same
+// rules as executeGitRemote: the deploy key over SSH, or token credentials
+// over HTTPS (SSH remotes included). Mirrors on another host than
+// config.GitRemote and other transports use their defaults (e.g. the SSH agent).
+func (goGitBackend) auth(repo *git.Repository, remoteName, token string) (string, transport.AuthMethod, error) {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(remote.Config().URLs) == 0 {
+		return "", nil, fmt.Errorf("remote %s has no url", remoteName)
+	}
+	remoteURL := remote.Config().URLs[0]
+
+	if remoteName != config.GitRemote && !sameRemoteHost(remoteURL) {
+		return remoteURL, nil, nil
+	}
+	if config.GitAuthMode == AuthDeployKey {
+		keys, err := gitssh.NewPublicKeysFromFile("git", config.GitDeployKeyPath, "")
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to load deploy key: %w", err)
+		}
+		if config.GitSSHKnownHosts != "" {
+			if keys.HostKeyCallback, err = gitssh.NewKnownHostsCallback(config.GitSSHKnownHosts); err != nil {
+				return "", nil, err
+			}
+		}
+		return sshRemoteURL(remoteURL), keys, nil
+	}
+
+	token, err = RepoToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+	u, ok := tokenRemoteURL(remoteURL)
+	if !ok || token == "" {
+		return remoteURL, nil, nil
+	}
+	return u.String(), &githttp.BasicAuth{Username: tokenUsername(), Password: token}, nil
+}
+
+func matchesPathspec(path string, pathspecs []string) bool {
+	if len(pathspecs) == 0 {
+		return true
+	}
+	for _, spec := range pathspecs {
+		spec = strings.TrimSuffix(spec, "/")
+		if spec == "." || path == spec || strings.HasPrefix(path, spec+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g goGitBackend) ShowHead(path string) ([]byte, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+func (g goGitBackend) Head() (string, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+func (g goGitBackend) ResolveRevision(rev string) (string, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return "", err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+func (g goGitBackend) RevisionExists(rev string) bool {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return false
+	}
+	rev, path, hasPath := strings.Cut(rev, ":")
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return false
+	}
+	if !hasPath {
+		return true
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return false
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return false
+	}
+	_, err = tree.FindEntry(path)
+	return err == nil
+}
+
+func (g goGitBackend) RemoteURL(remote string) (string, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return "", err
+	}
+	r, err := repo.Remote(remote)
+	if err != nil {
+		return "", fmt.Errorf("failed to get url of remote %s: %w", remote, err)
+	}
+	if len(r.Config().URLs) == 0 {
+		return "", fmt.Errorf("remote %s has no url", remote)
+	}
+	return r.Config().URLs[0], nil
+}
+
+func (g goGitBackend) AheadBehind(ref string) (int, int, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind, err := divergence(repo, "HEAD", ref)
+	return len(ahead), len(behind), err
+}
+
+func (g goGitBackend) CommitsSince(ref string) ([]models.UnpushedCommit, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	ahead, _, err := divergence(repo, "HEAD", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []models.UnpushedCommit{}
+	for _, c := range ahead {
+		commit := models.UnpushedCommit{Files: []string{}}
+		commit.SHA = c.Hash.String()
+		commit.Author = c.Author.Name
+		commit.Email = c.Author.Email
+		commit.Date = c.Author.When
+		commit.Message = strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0]
+		// Like git log, merges list no files
+		if c.NumParents() <= 1 {
+			var parent *object.Commit
+			if c.NumParents() == 1 {
+				if parent, err = c.Parent(0); err != nil {
+					return nil, err
+				}
+			}
+			if commit.Files, err = commitTreeChanges(parent, c); err != nil {
+				return nil, err
+			}
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+func (g goGitBackend) ChangedFiles(from, to string) ([]string, error) {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	var commits [2]*object.Commit
+	for i, rev := range []string{from, to} {
+		hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return nil, err
+		}
+		if commits[i], err = repo.CommitObject(*hash); err != nil {
+			return nil, err
+		}
+	}
+	return commitTreeChanges(commits[0], commits[1])
+}
+
+// commitTreeChanges lists the files that differ between the trees of two
+// commits; a nil from is the empty tree.
+func commitTreeChanges(from, to *object.Commit) ([]string, error) {
+	fromTree := &object.Tree{}
+	if from != nil {
+		var err error
+		if fromTree, err = from.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// divergence returns the commits reachable only from a and only from b,
+// newest first. Like git's merge base search it walks both histories by
+// commit date and stops once every commit left to visit is reachable from
+// both, so shared history is not walked.
+func divergence(repo *git.Repository, a, b string) ([]*object.Commit, []*object.Commit, error) {
+	const sideA, sideB = 1, 2
+	flags := map[plumbing.Hash]uint8{}
+	queue := &commitQueue{}
+	visit := func(hash plumbing.Hash, side uint8) error {
+		if flags[hash]|side == flags[hash] {
+			return nil
+		}
+		flags[hash] |= side
+		commit, err := repo.CommitObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil // Beyond a shallow clone's boundary
+		}
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, commit)
+		return nil
+	}
+	for i, rev := range []string{a, b} {
+		hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := visit(*hash, uint8(i+1)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for queue.Len() > 0 && !queue.allFlagged(flags, sideA|sideB) {
+		commit := heap.Pop(queue).(*object.Commit)
+		for _, parent := range commit.ParentHashes {
+			if err := visit(parent, flags[commit.Hash]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	var onlyA, onlyB []*object.Commit
+	for hash, f := range flags {
+		if f != sideA && f != sideB {
+			continue
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		if f == sideA {
+			onlyA = append(onlyA, commit)
+		} else {
+			onlyB = append(onlyB, commit)
+		}
+	}
+	for _, list := range [][]*object.Commit{onlyA, onlyB} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Committer.When.After(list[j].Committer.When) })
+	}
+	return onlyA, onlyB, nil
+}
+
+// commitQueue is a heap of commits, newest committer date first.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].Committer.When.After(q[j].Committer.When) }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)        { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+func (q commitQueue) allFlagged(flags map[plumbing.Hash]uint8, want uint8) bool {
+	for _, c := range q {
+		if flags[c.Hash] != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (g goGitBackend) Add(paths ...string) error {
+	_, wt, err := g.open()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if path == "." {
+			if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		// Add also removes index entries of deleted files
+		if _, err := wt.Add(path); err != nil {
+			return fmt.Errorf("add %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Commit records paths the way `git commit -- <paths>` does: the commit
+// holds HEAD plus the staged state of paths only, and whatever else is
+// staged stays staged. go-git always commits the whole index, so it is
+// given a temporary one holding just that.
+func (g goGitBackend) Commit(message string, author *models.GitUser, paths []string) (string, error) {
+	repo, wt, err := g.open()
+	if err != nil {
+		return "", err
+	}
+
+	if len(paths) > 0 {
+		staged, err := repo.Storer.Index()
+		if err != nil {
+			return "Failed to read index", err
+		}
+		selection, err := selectionIndex(repo, staged, paths)
+		if err != nil {
+			return err.Error(), err
+		}
+		if err := repo.Storer.SetIndex(selection); err != nil {
+			return "Failed to write index", err
+		}
+		defer func() {
+			if err := repo.Storer.SetIndex(staged); err != nil {
+				fmt.Printf("[GoGit] Warning: failed to restore index: %v\n", err)
+			}
+		}()
+	}
+
+	a, c := commitIdentity(author)
+	now := time.Now()
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author:    &object.Signature{Name: a.Name, Email: a.Email, When: now},
+		Committer: &object.Signature{Name: c.Name, Email: c.Email, When: now},
+	})
+	if err != nil {
+		return err.Error(), err
+	}
+	return fmt.Sprintf("[%s %s] %s", config.GitBranch, hash.String()[:7], strings.SplitN(message, "\n", 2)[0]), nil
+}
+
+// selectionIndex returns an index holding the HEAD tree with the entries
+// matching paths taken from staged instead. Unresolved conflicts in the
+// selection can't be committed.
+func selectionIndex(repo *git.Repository, staged *index.Index, paths []string) (*index.Index, error) {
+	selection := &index.Index{Version: staged.Version}
+
+	head, err := repo.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		// No commit yet: the selection is all there is
+	case err != nil:
+		return nil, err
+	default:
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, err
+		}
+		// A tree walker, unlike tree.Files, also yields submodules
+		walker := object.NewTreeWalker(tree, true, nil)
+		defer walker.Close()
+		for {
+			name, entry, err := walker.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if entry.Mode == filemode.Dir || matchesPathspec(name, paths) {
+				continue
+			}
+			selection.Entries = append(selection.Entries, &index.Entry{Name: name, Hash: entry.Hash, Mode: entry.Mode})
+		}
+	}
+
+	for _, entry := range staged.Entries {
+		if !matchesPathspec(entry.Name, paths) {
+			continue
+		}
+		// Stage 0 is merged (index.Merged is misnamed, it equals AncestorMode)
+		if entry.Stage != 0 {
+			return nil, fmt.Errorf("%s has unresolved conflicts", entry.Name)
+		}
+		selection.Entries = append(selection.Entries, entry)
+	}
+	sort.Slice(selection.Entries, func(i, j int) bool { return selection.Entries[i].Name < selection.Entries[j].Name })
+	return selection, nil
+}
+
+func (g goGitBackend) Fetch(token string) (string, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[GoGit] Fetch, Duration: %v\n", time.Since(start))
+	}()
+
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return "Failed to open repository", err
+	}
+	remoteURL, auth, err := g.auth(repo, config.GitRemote, token)
+	if err != nil {
+		return "Failed to get repository credential", err
+	}
+	refspec := gitconfig.RefSpec("+refs/heads/" + config.GitBranch + ":" + upstreamRef())
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: config.GitRemote,
+		RemoteURL:  remoteURL,
+		RefSpecs:   []gitconfig.RefSpec{refspec},
+		Auth:       auth,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return "Already up to date.", nil
+	}
+	if err != nil {
+		return err.Error(), err
+	}
+	return "Fetched " + config.GitRemote + "/" + config.GitBranch, nil
+}
+
+func (g goGitBackend) Push(remote, token string) (string, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[GoGit] Push, Duration: %v\n", time.Since(start))
+	}()
+
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return "Failed to open repository", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "Failed to resolve HEAD", err
+	}
+
+	remoteURL, auth, err := g.auth(repo, remote, token)
+	if err != nil {
+		return "Failed to get repository credential", err
+	}
+	refspec := gitconfig.RefSpec(head.Name().String() + ":refs/heads/" + config.GitBranch)
+	err = repo.Push(&git.PushOptions{
+		RemoteName: remote,
+		RemoteURL:  remoteURL,
+		RefSpecs:   []gitconfig.RefSpec{refspec},
+		Auth:       auth,
+	})
+	log := fmt.Sprintf("%s -> %s", head.Hash().String()[:7], config.GitBranch)
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		err, log = nil, "Everything up-to-date"
+	}
+	if err != nil {
+		// "non-fast-forward update" lets isPushRejected recognize a moved remote
+		return fmt.Sprintf("%s\n%s", log, err.Error()), err
+	}
+	if remote != config.GitRemote {
+		return log, nil
+	}
+
+	upstream := plumbing.NewHashReference(plumbing.ReferenceName(upstreamRef()), head.Hash())
+	if err := repo.Storer.SetReference(upstream); err != nil {
+		fmt.Printf("[GoGit] Warning: failed to update %s: %v\n", upstreamRef(), err)
+	}
+	return log, nil
+}
+
+// Pull fast-forwards HEAD to the remote branch, touching only the files
+// that changed upstream. go-git's own Pull refuses to run on a dirty
+// working tree, which is the normal state of a CMS checkout.
+func (g goGitBackend) Pull(token string, author *models.GitUser) (string, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[GoGit] Pull, Duration: %v\n", time.Since(start))
+	}()
+
+	if log, err := g.Fetch(token); err != nil {
+		return log, err
+	}
+
+	repo, wt, err := g.open()
+	if err != nil {
+		return "Failed to open repository", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "Failed to resolve HEAD", err
+	}
+	upstream, err := repo.Reference(plumbing.ReferenceName(upstreamRef()), true)
+	if err != nil {
+		return "Failed to resolve " + upstreamRef(), err
+	}
+	if head.Hash() == upstream.Hash() {
+		return "Already up to date.", nil
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "Failed to read HEAD", err
+	}
+	upstreamCommit, err := repo.CommitObject(upstream.Hash())
+	if err != nil {
+		return "Failed to read " + upstreamRef(), err
+	}
+	if ahead, _ := upstreamCommit.IsAncestor(headCommit); ahead {
+		return "Already up to date.", nil
+	}
+	if ff, _ := headCommit.IsAncestor(upstreamCommit); !ff {
+		return "Local and remote history have diverged; the gogit backend only fast-forwards (publish or use GIT_BACKEND=exec to merge)", git.ErrNonFastForwardUpdate
+	}
+
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return "Failed to read HEAD tree", err
+	}
+	upstreamTree, err := upstreamCommit.Tree()
+	if err != nil {
+		return "Failed to read upstream tree", err
+	}
+	diff, err := object.DiffTree(headTree, upstreamTree)
+	if err != nil {
+		return "Failed to diff trees", err
+	}
+
+	var files, blocked []string
+	for _, change := range diff {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		files = append(files, name)
+	}
+	if len(files) > 0 {
+		status, err := g.Status(files...)
+		if err != nil {
+			return "Failed to read status", err
+		}
+		for _, entry := range status {
+			blocked = append(blocked, entry.Path)
+		}
+	}
+	if len(blocked) > 0 {
+		return "Your local changes to the following files would be overwritten by merge:\n\t" + strings.Join(blocked, "\n\t"), fmt.Errorf("local changes would be overwritten")
+	}
+
+	// With no files listed Reset would touch the whole tree, so only move HEAD
+	mode := git.HardReset
+	if len(files) == 0 {
+		mode = git.SoftReset
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: upstream.Hash(), Mode: mode, Files: files}); err != nil {
+		return "Fast-forward failed", err
+	}
+	return fmt.Sprintf("Updating %s..%s\nFast-forward\n\t%s", head.Hash().String()[:7], upstream.Hash().String()[:7], strings.Join(files, "\n\t")), nil
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// treeFile is a file of the HEAD tree.
+type treeFile struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+// Status compares HEAD, the index and the working tree below the pathspecs
+// only; go-git's Worktree.Status always scans the whole repository. Like
+// git, files whose size and mtime match the index are not read.
+func (g goGitBackend) Status(pathspecs ...string) ([]StatusEntry, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[GoGit] Status %v, Duration: %v\n", pathspecs, time.Since(start))
+	}()
+
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	var specs []string
+	for _, spec := range pathspecs {
+		specs = append(specs, path.Clean(filepath.ToSlash(spec)))
+	}
+	if len(specs) == 0 {
+		specs = []string{"."}
+	}
+
+	head, err := headFiles(repo, specs)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	staged := map[string]*index.Entry{}
+	conflicted := map[string]bool{}
+	trackedDirs := map[string]bool{}
+	for _, entry := range idx.Entries {
+		if !matchesPathspec(entry.Name, specs) {
+			continue
+		}
+		// Stage 0 is merged (index.Merged is misnamed, it equals AncestorMode)
+		if entry.Stage != 0 {
+			conflicted[entry.Name] = true
+		}
+		staged[entry.Name] = entry
+		for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+	// Files changed after the index was written may have the same mtime
+	// as their entry, so only older entries are trusted
+	var indexTime time.Time
+	if info, err := os.Stat(filepath.Join(config.RepoPath, ".git", "index")); err == nil {
+		indexTime = info.ModTime()
+	}
+
+	disk, err := worktreeFiles(specs, staged, trackedDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for name := range head {
+		names[name] = true
+	}
+	for name := range staged {
+		names[name] = true
+	}
+	for name := range disk {
+		names[name] = true
+	}
+
+	var entries []StatusEntry
+	for name := range names {
+		h, inHead := head[name]
+		e, inIndex := staged[name]
+		info, onDisk := disk[name]
+
+		entry := StatusEntry{Path: name, Staging: byte(git.Unmodified), Worktree: byte(git.Unmodified)}
+		switch {
+		case conflicted[name]:
+			entry.Staging, entry.Worktree = byte(git.UpdatedButUnmerged), byte(git.UpdatedButUnmerged)
+		case !inIndex && !inHead:
+			entry.Staging, entry.Worktree = byte(git.Untracked), byte(git.Untracked)
+		default:
+			switch {
+			case inHead && !inIndex:
+				entry.Staging = byte(git.Deleted)
+			case !inHead && inIndex:
+				entry.Staging = byte(git.Added)
+			case h.hash != e.Hash || h.mode != e.Mode:
+				entry.Staging = byte(git.Modified)
+			}
+			switch {
+			case !inIndex && onDisk:
+				entry.Worktree = byte(git.Untracked)
+			case inIndex && !onDisk:
+				entry.Worktree = byte(git.Deleted)
+			case inIndex && worktreeChanged(name, e, info, indexTime):
+				entry.Worktree = byte(git.Modified)
+			}
+		}
+		if entry.Staging != byte(git.Unmodified) || entry.Worktree != byte(git.Unmodified) {
+			entries = append(entries, entry)
+		}
+	}
+	entries = detectRenames(entries, head, staged)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// headFiles returns the files of the HEAD tree below specs, none before
+// the first commit.
+func headFiles(repo *git.Repository, specs []string) (map[string]treeFile, error) {
+	files := map[string]treeFile{}
+	ref, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	root, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range specs {
+		tree, prefix := root, ""
+		if spec != "." {
+			entry, err := root.FindEntry(spec)
+			if err != nil {
+				continue // Not in HEAD
+			}
+			if entry.Mode != filemode.Dir {
+				files[spec] = treeFile{entry.Hash, entry.Mode}
+				continue
+			}
+			if tree, err = root.Tree(spec); err != nil {
+				return nil, err
+			}
+			prefix = spec + "/"
+		}
+
+		// A tree walker, unlike tree.Files, also yields submodules
+		walker := object.NewTreeWalker(tree, true, nil)
+		for {
+			name, entry, err := walker.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				walker.Close()
+				return nil, err
+			}
+			if entry.Mode != filemode.Dir {
+				files[prefix+name] = treeFile{entry.Hash, entry.Mode}
+			}
+		}
+		walker.Close()
+	}
+	return files, nil
+}
+
+// worktreeFiles returns the files on disk below specs, skipping ignored
+// files that aren't tracked, nested repositories and submodules.
+func worktreeFiles(specs []string, staged map[string]*index.Entry, trackedDirs map[string]bool) (map[string]fs.FileInfo, error) {
+	files := map[string]fs.FileInfo{}
+	ignore := newIgnoreRules()
+
+	for _, spec := range specs {
+		root := config.RepoPath
+		if spec != "." {
+			root = filepath.Join(config.RepoPath, filepath.FromSlash(spec))
+			// Rules of the directories above the spec apply too
+			for _, dir := range ancestorDirs(spec) {
+				ignore.load(dir)
+			}
+		}
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(full string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil // Removed while walking
+				}
+				return err
+			}
+			rel, err := filepath.Rel(config.RepoPath, full)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if d.IsDir() {
+				if rel == "." {
+					ignore.load("")
+					return nil
+				}
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if e, ok := staged[rel]; ok && e.Mode == filemode.Submodule {
+					return filepath.SkipDir
+				}
+				if _, err := os.Lstat(filepath.Join(full, ".git")); err == nil {
+					return filepath.SkipDir // A nested repository
+				}
+				if ignore.match(rel, true) {
+					if !trackedDirs[rel] {
+						return filepath.SkipDir
+					}
+					ignore.ignoreDir(rel)
+				}
+				ignore.load(rel)
+				return nil
+			}
+
+			if _, tracked := staged[rel]; !tracked && ignore.match(rel, false) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil // Removed while walking
+			}
+			files[rel] = info
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func ancestorDirs(spec string) []string {
+	dirs := []string{""}
+	parts := strings.Split(spec, "/")
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/"))
+	}
+	return dirs
+}
+
+// worktreeChanged reports whether a tracked file on disk differs from its
+// index entry.
+func worktreeChanged(name string, entry *index.Entry, info fs.FileInfo, indexTime time.Time) bool {
+	if entry.Mode == filemode.Submodule {
+		return false
+	}
+	mode, err := filemode.NewFromOSFileMode(info.Mode())
+	if err != nil || mode != entry.Mode {
+		return true
+	}
+	if entry.Size == uint32(info.Size()) && entry.ModifiedAt.Equal(info.ModTime()) && info.ModTime().Before(indexTime) {
+		return false
+	}
+
+	full := filepath.Join(config.RepoPath, filepath.FromSlash(name))
+	var content []byte
+	if mode == filemode.Symlink {
+		target, err := os.Readlink(full)
+		if err != nil {
+			return true
+		}
+		content = []byte(target)
+	} else if content, err = os.ReadFile(full); err != nil {
+		return true
+	}
+	return plumbing.ComputeHash(plumbing.BlobObject, content) != entry.Hash
+}
+
+// detectRenames pairs staged deletions with staged additions of the same
+// content, as git status does for exact renames.
+func detectRenames(entries []StatusEntry, head map[string]treeFile, staged map[string]*index.Entry) []StatusEntry {
+	deleted := map[plumbing.Hash]int{}
+	for i, entry := range entries {
+		if entry.Staging == byte(git.Deleted) {
+			deleted[head[entry.Path].hash] = i
+		}
+	}
+	if len(deleted) == 0 {
+		return entries
+	}
+
+	removed := map[int]bool{}
+	for i, entry := range entries {
+		if entry.Staging != byte(git.Added) {
+			continue
+		}
+		j, ok := deleted[staged[entry.Path].Hash]
+		if !ok {
+			continue
+		}
+		delete(deleted, staged[entry.Path].Hash)
+		entries[i].Staging = byte(git.Renamed)
+		entries[i].OldPath = entries[j].Path
+		if entries[j].Worktree == byte(git.Untracked) {
+			// The old path is back on disk, untracked
+			entries[j].Staging = byte(git.Untracked)
+		} else {
+			removed[j] = true
+		}
+	}
+
+	kept := entries[:0]
+	for i, entry := range entries {
+		if !removed[i] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// ignoreRules collects .gitignore patterns of the directories visited.
+type ignoreRules struct {
+	patterns    []gitignore.Pattern
+	loaded      map[string]bool
+	ignoredDirs map[string]bool // Ignored but walked, as they hold tracked files
+}
+
+func newIgnoreRules() *ignoreRules {
+	rules := &ignoreRules{loaded: map[string]bool{}, ignoredDirs: map[string]bool{}}
+	rules.read(filepath.Join(config.RepoPath, ".git", "info", "exclude"), nil)
+	return rules
+}
+
+// load adds the .gitignore of a repo-relative directory ("" is the root).
+func (r *ignoreRules) load(dir string) {
+	if r.loaded[dir] {
+		return
+	}
+	r.loaded[dir] = true
+	var domain []string
+	if dir != "" {
+		domain = strings.Split(dir, "/")
+	}
+	r.read(filepath.Join(config.RepoPath, filepath.FromSlash(dir), ".gitignore"), domain)
+}
+
+func (r *ignoreRules) read(file string, domain []string) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r.patterns = append(r.patterns, gitignore.ParsePattern(line, domain))
+	}
+}
+
+func (r *ignoreRules) ignoreDir(dir string) {
+	r.ignoredDirs[dir] = true
+}
+
+func (r *ignoreRules) match(rel string, isDir bool) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if r.ignoredDirs[dir] {
+			return true
+		}
+	}
+	return gitignore.NewMatcher(r.patterns).Match(strings.Split(rel, "/"), isDir)
+}
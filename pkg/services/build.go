@@ -0,0 +1,490 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Build job states.
+const (
+	BuildQueued    = "queued"
+	BuildRunning   = "running"
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+)
+
+// Deploy methods (config.DeployMethod).
+const (
+	DeployLocal = "local"
+	DeployRsync = "rsync"
+)
+
+var ErrBuildNotFound = errors.New("build not found")
+
+// buildQueue runs production builds one at a time. Jobs are kept newest
+// first and persisted next to their output, so the history survives restarts.
+type buildQueue struct {
+	mu      sync.Mutex
+	jobs    []*models.BuildJob
+	pending *models.BuildJob
+	wake    chan struct{}
+	once    sync.Once
+}
+
+var builds = &buildQueue{wake: make(chan struct{}, 1)}
+
+func buildsDir() string {
+	return filepath.Join(config.CMSDataDir, "builds")
+}
+
+// init loads the persisted jobs and starts the worker on first use.
+func (q *buildQueue) init() {
+	q.once.Do(func() {
+		q.jobs = loadBuildJobs()
+		go q.worker()
+	})
+}
+
+// StartBuild queues a production build and deploy. While a build is
+// waiting to start, further requests return that job instead of queueing
+// another one.
+func StartBuild(user *models.GitUser) models.BuildJob {
+	builds.init()
+	builds.mu.Lock()
+	defer builds.mu.Unlock()
+
+	if builds.pending != nil {
+		return *builds.pending
+	}
+
+	job := &models.BuildJob{
+		ID:        newBuildID(),
+		Status:    BuildQueued,
+		CreatedAt: time.Now(),
+	}
+	if user != nil {
+		job.RequestedBy = user.DisplayName()
+	}
+	builds.jobs = append([]*models.BuildJob{job}, builds.jobs...)
+	builds.pending = job
+
+	select {
+	case builds.wake <- struct{}{}:
+	default:
+	}
+	fmt.Printf("[Build] Queued %s\n", job.ID)
+	return *job
+}
+
+// ListBuilds returns the kept jobs, newest first, without their logs.
+func ListBuilds() []models.BuildJob {
+	builds.init()
+	builds.mu.Lock()
+	defer builds.mu.Unlock()
+
+	list := make([]models.BuildJob, 0, len(builds.jobs))
+	for _, job := range builds.jobs {
+		j := *job
+		j.Log = ""
+		list = append(list, j)
+	}
+	return list
+}
+
+func GetBuild(id string) (models.BuildJob, error) {
+	builds.init()
+	builds.mu.Lock()
+	defer builds.mu.Unlock()
+
+	for _, job := range builds.jobs {
+		if job.ID == id {
+			return *job, nil
+		}
+	}
+	return models.BuildJob{}, ErrBuildNotFound
+}
+
+// newBuildID returns a sortable, unique id. Called with builds.mu held.
+func newBuildID() string {
+	id := time.Now().UTC().Format("20060102-150405")
+	for n := 2; ; n++ {
+		taken := false
+		for _, job := range builds.jobs {
+			if job.ID == id {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", id[:15], n)
+	}
+}
+
+func (q *buildQueue) worker() {
+	for range q.wake {
+		q.mu.Lock()
+		job := q.pending
+		q.pending = nil
+		var running models.BuildJob
+		if job != nil {
+			job.Status = BuildRunning
+			job.StartedAt = time.Now()
+			running = *job
+		}
+		q.mu.Unlock()
+		if job == nil {
+			continue
+		}
+		// Saved right away so a restart can tell the build was interrupted
+		if err := saveBuildJob(running); err != nil {
+			fmt.Printf("[Build] Failed to save %s: %v\n", running.ID, err)
+		}
+
+		result := runBuildJob(running)
+
+		q.mu.Lock()
+		*job = result
+		q.mu.Unlock()
+		if err := saveBuildJob(result); err != nil {
+			fmt.Printf("[Build] Failed to save %s: %v\n", result.ID, err)
+		}
+		q.prune()
+	}
+}
+
+func runBuildJob(job models.BuildJob) models.BuildJob {
+	fmt.Printf("[Build] Starting %s\n", job.ID)
+
+	// The working tree holds saved but unpublished edits, so the committed
+	// revision is exported and built instead. Only the export runs in the
+	// repository queue, where a sync or save can't move HEAD halfway through.
+	source := filepath.Join(buildsDir(), job.ID, "source")
+	output := filepath.Join(buildsDir(), job.ID, "public")
+	defer os.RemoveAll(source)
+	var log string
+	var err error
+	if queueErr := Repo.Run("build", false, func() error {
+		if job.Revision, err = GetGitBackend().Head(); err != nil {
+			log = "Failed to resolve HEAD"
+			return nil
+		}
+		if err = exportRevision(job.Revision, source); err != nil {
+			log = "Failed to export " + job.Revision
+		}
+		return nil
+	}); queueErr != nil {
+		log, err = "Failed to queue the build", queueErr
+	}
+	if err == nil {
+		log, err = BuildSite(source, output)
+	}
+	if err == nil && config.DeployMethod != "" {
+		var deployLog string
+		deployLog, err = DeploySite(output)
+		log += "\n--- Deploy (" + config.DeployMethod + ") ---\n" + deployLog
+		if err == nil {
+			job.Deploy = config.DeployMethod
+		}
+	}
+
+	job.Log = log
+	job.FinishedAt = time.Now()
+	job.Duration = job.FinishedAt.Sub(job.StartedAt).Round(time.Millisecond).String()
+	job.Status = BuildSucceeded
+	if err != nil {
+		job.Status = BuildFailed
+		job.Error = err.Error()
+	}
+	fmt.Printf("[Build] %s %s in %s\n", job.ID, job.Status, job.Duration)
+	return job
+}
+
+// DeploySite publishes a build output according to config.DeployMethod.
+func DeploySite(output string) (string, error) {
+	if config.DeployPath == "" {
+		return "DEPLOY_PATH is not set", errors.New("no deploy path configured")
+	}
+	switch config.DeployMethod {
+	case DeployLocal:
+		return deployLocal(output, config.DeployPath)
+	case DeployRsync:
+		// The trailing slash syncs the contents, not the directory itself
+		cmd := exec.Command("rsync", "-a", "--delete", "--stats", output+string(filepath.Separator), config.DeployPath)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	default:
+		return "", fmt.Errorf("unknown deploy method %q", config.DeployMethod)
+	}
+}
+
+// deployLocal replaces target with a copy of output. The copy is made next
+// to target and swapped in with renames, so the site is never half-updated.
+func deployLocal(output, target string) (string, error) {
+	target = filepath.Clean(target)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "Failed to create deploy directory", err
+	}
+
+	staging := target + ".deploying"
+	previous := target + ".previous"
+	os.RemoveAll(staging)
+	os.RemoveAll(previous)
+
+	files, err := copyDir(output, staging)
+	if err != nil {
+		os.RemoveAll(staging)
+		return "Failed to copy build output", err
+	}
+	if _, err := os.Stat(target); err == nil {
+		if err := os.Rename(target, previous); err != nil {
+			os.RemoveAll(staging)
+			return "Failed to move current site aside", err
+		}
+	}
+	if err := os.Rename(staging, target); err != nil {
+		// Put the old site back
+		os.Rename(previous, target)
+		return "Failed to move new site into place", err
+	}
+	os.RemoveAll(previous)
+	return fmt.Sprintf("Copied %d file(s) to %s", files, target), nil
+}
+
+// exportRevision writes the files of commit rev to dir. Files the working
+// tree holds unchanged are copied from it, so filters such as Git LFS still
+// apply; submodules (e.g. themes) are copied from their checkout and
+// node_modules is linked for Hugo Pipes.
+func exportRevision(rev, dir string) error {
+	repo, err := git.PlainOpen(config.RepoPath)
+	if err != nil {
+		return err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return err
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	entries, err := GetGitBackend().Status()
+	if err != nil {
+		return err
+	}
+	changed := map[string]bool{}
+	for _, entry := range entries {
+		changed[entry.Path] = true
+		if entry.OldPath != "" {
+			changed[entry.OldPath] = true
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		live := filepath.Join(config.RepoPath, filepath.FromSlash(name))
+		if entry.Mode == filemode.Dir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if entry.Mode == filemode.Submodule {
+			if _, err := copyDir(live, target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := exportFile(repo, entry, live, target, changed[name]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(config.RepoPath, "node_modules")); err == nil {
+		return os.Symlink(filepath.Join(config.RepoPath, "node_modules"), filepath.Join(dir, "node_modules"))
+	}
+	return nil
+}
+
+// exportFile writes the blob of a tree entry to target, or copies live when
+// it holds the same content unfiltered.
+func exportFile(repo *git.Repository, entry object.TreeEntry, live, target string, changed bool) error {
+	mode := os.FileMode(0644)
+	if entry.Mode == filemode.Executable {
+		mode = 0755
+	}
+	if !changed && entry.Mode != filemode.Symlink {
+		if info, err := os.Lstat(live); err == nil && info.Mode().IsRegular() {
+			if err := copyFile(live, target); err != nil {
+				return err
+			}
+			return os.Chmod(target, mode)
+		}
+	}
+
+	blob, err := repo.BlobObject(entry.Hash)
+	if err != nil {
+		return err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if entry.Mode == filemode.Symlink {
+		link, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(link), target)
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func copyDir(src, dst string) (int, error) {
+	files := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		files++
+		return copyFile(path, target)
+	})
+	return files, err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// prune deletes the jobs and outputs beyond config.BuildKeep.
+func (q *buildQueue) prune() {
+	q.mu.Lock()
+	var removed []string
+	kept := q.jobs[:0]
+	for i, job := range q.jobs {
+		if i >= config.BuildKeep && job.Status != BuildQueued && job.Status != BuildRunning {
+			removed = append(removed, job.ID)
+			continue
+		}
+		kept = append(kept, job)
+	}
+	q.jobs = kept
+	q.mu.Unlock()
+
+	for _, id := range removed {
+		if err := os.RemoveAll(filepath.Join(buildsDir(), id)); err != nil {
+			fmt.Printf("[Build] Failed to remove %s: %v\n", id, err)
+		}
+	}
+}
+
+func saveBuildJob(job models.BuildJob) error {
+	dir := filepath.Join(buildsDir(), job.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "build.json"), data, 0644)
+}
+
+func loadBuildJobs() []*models.BuildJob {
+	entries, err := os.ReadDir(buildsDir())
+	if err != nil {
+		return nil
+	}
+
+	var jobs []*models.BuildJob
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(buildsDir(), entry.Name(), "build.json"))
+		if err != nil {
+			continue
+		}
+		var job models.BuildJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			fmt.Printf("[Build] Ignoring %s: %v\n", entry.Name(), err)
+			continue
+		}
+		if job.Status == BuildQueued || job.Status == BuildRunning {
+			job.Status = BuildFailed
+			job.Error = "interrupted by a restart"
+		}
+		jobs = append(jobs, &job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs
+}
@@ -4,10 +4,8 @@ import (
 	"fmt"
 	"hugo-cms/pkg/config"
 	"hugo-cms/pkg/models"
-	"io"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -20,6 +18,9 @@ var (
 	cacheLoaded  bool
 )
 
+// GetArticlesCache returns all articles, scanning content/ on first use.
+// Files unchanged since the on-disk index was written are not read again,
+// so a restart only pays for what changed in the meantime.
 func GetArticlesCache() ([]models.Article, error) {
 	start := time.Now()
 	cacheMutex.Lock()
@@ -29,20 +30,33 @@ func GetArticlesCache() ([]models.Article, error) {
 		return articleCache, nil
 	}
 
+	refreshed := 0
 	defer func() {
-		fmt.Printf("[Cache] Rebuild All Duration: %v, Count: %d\n", time.Since(start), len(articleCache))
+		fmt.Printf("[Cache] Rebuild All Duration: %v, Count: %d, Refreshed: %d\n", time.Since(start), len(articleCache), refreshed)
 	}()
 
 	contentDir := filepath.Join(config.RepoPath, "content")
-	dirtyFiles, _ := getGitDirtyFiles(config.RepoPath)
+	index := loadIndexEntries()
+	head := gitHead()
+	changedFiles, _ := getGitChangedFiles()
+	unpushedFiles := unpushedContentFiles()
 
-	var paths []string
+	type scanned struct {
+		path string
+		info fs.FileInfo
+	}
+	var files []scanned
+	formats := currentContentFormats()
 	err := filepath.WalkDir(contentDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".md") {
-			paths = append(paths, path)
+		if !d.IsDir() && formats.isContent(path) {
+			info, err := d.Info()
+			if err != nil {
+				return nil // Removed while walking
+			}
+			files = append(files, scanned{path, info})
 		}
 		return nil
 	})
@@ -51,109 +65,81 @@ func GetArticlesCache() ([]models.Article, error) {
 		return nil, err
 	}
 
-	articles := make([]models.Article, len(paths))
+	articles := make([]models.Article, len(files))
+	entries := make([]indexEntry, len(files))
+	keys := make([]string, len(files))
 	var wg sync.WaitGroup
+	var refreshedMu sync.Mutex
 	sem := make(chan struct{}, config.CacheConcurrency) // Limit concurrency
 
-	for i, path := range paths {
+	for i, file := range files {
 		wg.Add(1)
-		go func(i int, path string) {
+		go func(i int, path string, info fs.FileInfo) {
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
 			relPath, _ := filepath.Rel(contentDir, path)
+			keys[i] = filepath.ToSlash(relPath)
+			repoRelPath := "content/" + keys[i]
 
-			repoRelPath, _ := filepath.Rel(config.RepoPath, path)
-			repoRelPath = filepath.ToSlash(repoRelPath)
-			isDirty := dirtyFiles[repoRelPath]
-
-			// Read file to get title (Limit for performance)
-			content, err := readHead(path, config.FileReadHeadLimit)
-			title := relPath // Default to path
-			if err == nil {
-				fm, _, _, err := ParseFrontMatter(content)
-				if err == nil {
-					if t, ok := fm["title"].(string); ok {
-						title = t
-					}
-				}
+			cached, found := index[keys[i]]
+			entry, updated, err := refreshIndexEntry(path, repoRelPath, info, cached, found, head, changedFiles[repoRelPath])
+			if err != nil {
+				entry = indexEntry{Title: relPath}
 			}
-
-			articles[i] = models.Article{
-				Path:    relPath,
-				Title:   title,
-				IsDirty: isDirty,
+			if updated {
+				refreshedMu.Lock()
+				refreshed++
+				refreshedMu.Unlock()
 			}
-		}(i, path)
+			entries[i] = entry
+
+			articles[i] = entry.article(relPath)
+			articles[i].IsUnpushed = unpushedFiles[keys[i]]
+		}(i, file.path, file.info)
 	}
 
 	wg.Wait()
 
+	if refreshed > 0 || len(index) != len(files) {
+		fresh := make(map[string]indexEntry, len(files))
+		for i, key := range keys {
+			if entries[i].Hash != "" {
+				fresh[key] = entries[i]
+			}
+		}
+		replaceIndexEntries(fresh)
+	}
+
 	articleCache = articles
 	cacheLoaded = true
 	return articleCache, nil
 }
 
-func readHead(path string, limit int64) ([]byte, error) {
-	f, err := os.Open(path)
+// gitHead returns the commit checked out, or "" before the first commit.
+func gitHead() string {
+	head, err := GetGitBackend().Head()
 	if err != nil {
-		return nil, err
+		return ""
 	}
-	defer f.Close()
-
-	buf := make([]byte, limit)
-	n, err := f.Read(buf)
-	// io.EOF is acceptable if file is smaller than limit
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	return buf[:n], nil
+	return head
 }
 
-func getGitDirtyFiles(dir string) (map[string]bool, error) {
-	cmd := exec.Command("git", "status", "--porcelain", "--", "content")
-	cmd.Dir = dir
-	out, err := cmd.Output()
+// getGitChangedFiles returns the repo-relative paths below content/ that git
+// reports as changed. Whether they differ semantically is left to the caller.
+func getGitChangedFiles() (map[string]bool, error) {
+	// Untracked files are listed individually by the backend
+	entries, err := GetGitBackend().Status("content")
 	if err != nil {
 		return nil, err
 	}
 
-	dirty := make(map[string]bool)
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if len(line) < 4 {
-			continue
-		}
-		path := strings.TrimSpace(line[3:])
-		path = strings.Trim(path, "\"")
-		path = filepath.ToSlash(path)
-
-		diff, diffErr := CheckSemanticDiff(path)
-		if diffErr != nil || diff {
-			dirty[path] = true
-		}
+	changed := make(map[string]bool)
+	for _, entry := range entries {
+		changed[filepath.ToSlash(entry.Path)] = true
 	}
-
-	cmdUntracked := exec.Command("git", "ls-files", "--others", "--exclude-standard", "--", "content")
-	cmdUntracked.Dir = dir
-	if outUntracked, errUntracked := cmdUntracked.Output(); errUntracked == nil {
-		for _, raw := range strings.Split(string(outUntracked), "\n") {
-			path := strings.TrimSpace(raw)
-			if path == "" {
-				continue
-			}
-			path = filepath.ToSlash(path)
-			if _, exists := dirty[path]; exists {
-				continue
-			}
-			diff, diffErr := CheckSemanticDiff(path)
-			if diffErr != nil || diff {
-				dirty[path] = true
-			}
-		}
-	}
-	return dirty, nil
+	return changed, nil
 }
 
 func InvalidateCache() {
@@ -161,6 +147,25 @@ func InvalidateCache() {
 	defer cacheMutex.Unlock()
 	cacheLoaded = false
 	articleCache = nil
+	invalidateSearchIndex()
+}
+
+// removeCacheEntries drops the entry of relPath and, for a directory, the
+// entries below it.
+func removeCacheEntries(relPath string) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	prefix := relPath + string(filepath.Separator)
+	kept := articleCache[:0]
+	for _, art := range articleCache {
+		if art.Path != relPath && !strings.HasPrefix(art.Path, prefix) {
+			kept = append(kept, art)
+		}
+	}
+	articleCache = kept
+	deleteIndexEntries(filepath.ToSlash(relPath))
+	updateSearchIndex(relPath)
 }
 
 func UpdateCache(relPath string) {
@@ -168,6 +173,8 @@ func UpdateCache(relPath string) {
 	defer func() {
 		fmt.Printf("[Cache] Update Single: %s, Duration: %v\n", relPath, time.Since(start))
 	}()
+	updateSearchIndex(relPath)
+	unpushed := unpushedContentFiles()
 
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
@@ -177,9 +184,11 @@ func UpdateCache(relPath string) {
 	}
 
 	fullPath := filepath.Join(config.RepoPath, "content", relPath)
+	key := filepath.ToSlash(relPath)
 
 	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
 		// Remove from cache
 		for i, art := range articleCache {
 			if art.Path == relPath {
@@ -187,31 +196,26 @@ func UpdateCache(relPath string) {
 				break
 			}
 		}
+		deleteIndexEntries(key)
 		return
 	}
-
-	// For now assuming update/create means it exists or we handle error
-	content, err := readHead(fullPath, config.FileReadHeadLimit)
 	if err != nil {
-		return // Ignore error, maybe remove from cache if not found?
+		return
 	}
 
-	title := relPath
-	fm, _, _, err := ParseFrontMatter(content)
-	if err == nil {
-		if t, ok := fm["title"].(string); ok {
-			title = t
-		}
+	changed, _ := gitFileChanged(relPath)
+	cached, indexed := getIndexEntry(key)
+	entry, updated, err := refreshIndexEntry(fullPath, "content/"+key, info, cached, indexed, gitHead(), changed)
+	if err != nil {
+		return
 	}
-
-	isDirty, _ := getGitFileStatus(relPath)
-
-	newArt := models.Article{
-		Path:    relPath,
-		Title:   title,
-		IsDirty: isDirty,
+	if updated {
+		putIndexEntry(key, entry)
 	}
 
+	newArt := entry.article(relPath)
+	newArt.IsUnpushed = unpushed[key]
+
 	found := false
 	for i, art := range articleCache {
 		if art.Path == relPath {
@@ -225,20 +229,13 @@ func UpdateCache(relPath string) {
 	}
 }
 
-func getGitFileStatus(relPath string) (bool, error) {
-	// git status --porcelain content/posts/xxx.md
+// gitFileChanged reports whether git lists the content-relative relPath as
+// changed; refreshIndexEntry decides whether it differs semantically.
+func gitFileChanged(relPath string) (bool, error) {
 	// Note: relPath is relative to content/, but git needs relative to RepoPath
-	target := filepath.Join("content", relPath)
-	targetGit := filepath.ToSlash(target)
-	cmd := exec.Command("git", "status", "--porcelain", targetGit)
-	cmd.Dir = config.RepoPath
-	out, err := cmd.Output()
+	entries, err := GetGitBackend().Status(filepath.ToSlash(filepath.Join("content", relPath)))
 	if err != nil {
 		return false, err
 	}
-	if len(strings.TrimSpace(string(out))) > 0 {
-		// Verify semantically
-		return CheckSemanticDiff(targetGit)
-	}
-	return false, nil
+	return len(entries) > 0, nil
 }
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change types reported by ListChanges.
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+	ChangeRenamed  = "renamed"
+)
+
+// mediaReference matches markdown images/links and HTML src/href attributes.
+var mediaReference = regexp.MustCompile(`!?\[[^\]]*\]\(\s*<?([^)\s>]+)|(?:src|href)\s*=\s*["']([^"']+)["']`)
+
+// isContentPage reports whether a repo-relative path is an article; batches
+// use contentFormats.isContentPage directly.
+func isContentPage(repoPath string) bool {
+	return currentContentFormats().isContentPage(repoPath)
+}
+
+func changeType(x, y byte) string {
+	switch {
+	case x == '?' || x == 'A':
+		return ChangeAdded
+	case x == 'R' || y == 'R':
+		return ChangeRenamed
+	case x == 'D' || y == 'D':
+		return ChangeDeleted
+	default:
+		return ChangeModified
+	}
+}
+
+// ListChanges returns every dirty content and media file. Content pages whose
+// only differences are formatting (see CheckSemanticDiff) are left out.
+func ListChanges() ([]models.Change, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[Changes] List Duration: %v\n", time.Since(start))
+	}()
+
+	all, err := statusChanges("content", "static")
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []models.Change{}
+	for _, change := range all {
+		if change.Kind == "content" && change.Type == ChangeModified {
+			if diff, err := CheckSemanticDiff(change.Path); err == nil && !diff {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// statusChanges converts the backend status of the given pathspecs into changes.
+func statusChanges(pathspecs ...string) ([]models.Change, error) {
+	entries, err := GetGitBackend().Status(pathspecs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.Change
+	formats := currentContentFormats()
+	for _, entry := range entries {
+		change := models.Change{
+			Path:    entry.Path,
+			OldPath: entry.OldPath,
+			Type:    changeType(entry.Staging, entry.Worktree),
+			Kind:    "media",
+		}
+		if formats.isContentPage(change.Path) {
+			change.Kind = "content"
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// referencedMedia returns the repo-relative paths of files referenced from an
+// article's body and front matter: "/x.png" resolves into static/, anything
+// else relative to the article's directory.
+func referencedMedia(repoPath string) []string {
+	content, err := os.ReadFile(filepath.Join(config.RepoPath, filepath.FromSlash(repoPath)))
+	if err != nil {
+		return nil
+	}
+
+	var refs []string
+	for _, m := range mediaReference.FindAllStringSubmatch(string(content), -1) {
+		if m[1] != "" {
+			refs = append(refs, m[1])
+		} else {
+			refs = append(refs, m[2])
+		}
+	}
+	if fm, _, _, err := ParseFrontMatter(content); err == nil {
+		collectStrings(fm, &refs)
+	}
+
+	articleDir := filepath.ToSlash(filepath.Dir(repoPath))
+	seen := make(map[string]bool)
+	var paths []string
+	for _, ref := range refs {
+		if strings.Contains(ref, "://") || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "mailto:") {
+			continue
+		}
+		if i := strings.IndexAny(ref, "?#"); i >= 0 {
+			ref = ref[:i]
+		}
+		if unescaped, err := url.PathUnescape(ref); err == nil {
+			ref = unescaped
+		}
+
+		var target string
+		if strings.HasPrefix(ref, "/") {
+			target = filepath.ToSlash(filepath.Join("static", ref))
+		} else {
+			target = filepath.ToSlash(filepath.Join(articleDir, ref))
+		}
+		if strings.HasPrefix(target, "..") || seen[target] {
+			continue
+		}
+		seen[target] = true
+		paths = append(paths, target)
+	}
+	return paths
+}
+
+func collectStrings(value interface{}, out *[]string) {
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, "/") || strings.Contains(v, ".") {
+			*out = append(*out, strings.TrimSpace(v))
+		}
+	case map[string]interface{}:
+		for _, inner := range v {
+			collectStrings(inner, out)
+		}
+	case []interface{}:
+		for _, inner := range v {
+			collectStrings(inner, out)
+		}
+	}
+}
+
+// expandPublishPaths adds to the selected repo-relative paths the changed media
+// they reference. Deleted leaf bundles take their remaining changes with them.
+func expandPublishPaths(selected []string, changes []models.Change) []string {
+	changed := make(map[string]models.Change, len(changes))
+	for _, ch := range changes {
+		changed[ch.Path] = ch
+	}
+
+	include := make(map[string]bool)
+	add := func(path string) {
+		include[path] = true
+		if ch, ok := changed[path]; ok && ch.OldPath != "" {
+			include[ch.OldPath] = true
+		}
+	}
+
+	formats := currentContentFormats()
+	for _, path := range selected {
+		path = filepath.ToSlash(filepath.Clean(path))
+		if _, ok := changed[path]; ok {
+			add(path)
+		}
+		if !formats.isContentPage(path) {
+			continue
+		}
+
+		if ch, ok := changed[path]; ok && ch.Type == ChangeDeleted && formats.isBundleIndex(path) {
+			bundleDir := filepath.ToSlash(filepath.Dir(path)) + "/"
+			for p := range changed {
+				if strings.HasPrefix(p, bundleDir) {
+					add(p)
+				}
+			}
+			continue
+		}
+
+		for _, ref := range referencedMedia(path) {
+			if _, ok := changed[ref]; ok {
+				add(ref)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(include))
+	for p := range include {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
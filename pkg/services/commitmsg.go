@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Commit message actions, matching the keys of Decap's backend.commit_messages.
+const (
+	CommitCreate      = "create"
+	CommitUpdate      = "update"
+	CommitDelete      = "delete"
+	CommitUploadMedia = "uploadMedia"
+	CommitDeleteMedia = "deleteMedia"
+)
+
+var defaultCommitMessages = models.CommitMessages{
+	Create:      "Create {{path}} via HomeCMS",
+	Update:      "Update {{path}} via HomeCMS",
+	Delete:      "Delete {{path}} via HomeCMS",
+	UploadMedia: "Upload {{path}} via HomeCMS",
+	DeleteMedia: "Delete {{path}} via HomeCMS",
+}
+
+var commitPlaceholder = regexp.MustCompile(`{{([^}]+)}}`)
+
+func commitTemplate(action string) string {
+	configured := models.CommitMessages{}
+	if cfg, err := GetCMSConfig(); err == nil {
+		configured = cfg.Backend.CommitMessages
+	}
+
+	pick := func(custom, fallback string) string {
+		if custom != "" {
+			return custom
+		}
+		return fallback
+	}
+
+	switch action {
+	case CommitCreate:
+		return pick(configured.Create, defaultCommitMessages.Create)
+	case CommitDelete:
+		return pick(configured.Delete, defaultCommitMessages.Delete)
+	case CommitUploadMedia:
+		return pick(configured.UploadMedia, defaultCommitMessages.UploadMedia)
+	case CommitDeleteMedia:
+		return pick(configured.DeleteMedia, defaultCommitMessages.DeleteMedia)
+	default:
+		return pick(configured.Update, defaultCommitMessages.Update)
+	}
+}
+
+// RenderCommitMessage fills the template for action with values describing
+// the repo-relative path being committed.
+func RenderCommitMessage(action, repoPath string, author *models.GitUser) string {
+	repoPath = filepath.ToSlash(repoPath)
+	data := map[string]string{
+		"path": repoPath,
+		"slug": filepath.Base(WorkflowSlug(strings.TrimPrefix(repoPath, "content/"))),
+	}
+	if collection, err := GetCollectionForPath(repoPath); err == nil {
+		data["collection"] = collection.Name
+	}
+	if author != nil {
+		data["author-login"] = author.Login
+		data["author-name"] = author.DisplayName()
+	}
+
+	return commitPlaceholder.ReplaceAllStringFunc(commitTemplate(action), func(match string) string {
+		key := strings.TrimSpace(match[2 : len(match)-2])
+		return data[key]
+	})
+}
+
+// commitActionForPath classifies a repo-relative path by comparing the
+// working tree to HEAD.
+func commitActionForPath(repoPath string) string {
+	repoPath = filepath.ToSlash(repoPath)
+	isContent := isContentPage(repoPath)
+
+	_, statErr := os.Stat(filepath.Join(config.RepoPath, filepath.FromSlash(repoPath)))
+	existsOnDisk := statErr == nil
+	existsAtHead := refExists("HEAD:" + repoPath)
+
+	switch {
+	case !existsOnDisk && isContent:
+		return CommitDelete
+	case !existsOnDisk:
+		return CommitDeleteMedia
+	case !isContent:
+		return CommitUploadMedia
+	case !existsAtHead:
+		return CommitCreate
+	default:
+		return CommitUpdate
+	}
+}
+
+// defaultPublishMessage builds the commit message for a publish when the
+// editor did not supply one. Only a single selected path uses a template.
+func defaultPublishMessage(repoPaths []string, author *models.GitUser) string {
+	if len(repoPaths) != 1 {
+		return fmt.Sprintf("Update via HomeCMS: %s", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	return RenderCommitMessage(commitActionForPath(repoPaths[0]), repoPaths[0], author)
+}
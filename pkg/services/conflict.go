@@ -0,0 +1,283 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Conflict resolutions accepted by ResolveConflict.
+const (
+	ResolveOurs   = "ours"
+	ResolveTheirs = "theirs"
+	ResolveManual = "manual"
+)
+
+// MergeConflictError is returned by SyncRepo when the pull stopped on conflicts.
+// The merge is left in progress so it can be resolved through the API.
+type MergeConflictError struct {
+	Files []string
+}
+
+func (e *MergeConflictError) Error() string {
+	if len(e.Files) == 0 {
+		return "merge in progress"
+	}
+	return fmt.Sprintf("merge conflict in %d file(s): %s", len(e.Files), strings.Join(e.Files, ", "))
+}
+
+// localChangesRef holds the uncommitted changes SyncRepo set aside for its
+// merge until they are applied again on the merged tree.
+const localChangesRef = "refs/cms/local-changes"
+
+// IsMerging reports whether a sync is unfinished: its merge is in progress
+// or the local changes it set aside are not restored yet.
+func IsMerging() bool {
+	return refExists("MERGE_HEAD") || refExists(localChangesRef)
+}
+
+// restoringLocalChanges reports whether the conflicts in the index come from
+// applying local changes after a sync rather than from its merge.
+func restoringLocalChanges() bool {
+	return !refExists("MERGE_HEAD") && refExists(localChangesRef)
+}
+
+// stashLocalChanges sets uncommitted changes to tracked files aside in
+// localChangesRef, as merge and rebase refuse to overwrite them, and
+// reports whether there were any.
+func stashLocalChanges() (bool, error) {
+	out, err := runGit(commitIdentityEnv(nil), nil, "stash", "create", "Local changes during sync")
+	if err != nil {
+		return false, err
+	}
+	stash := strings.TrimSpace(out)
+	if stash == "" {
+		return false, nil
+	}
+	if _, err := runGit(nil, nil, "update-ref", localChangesRef, stash); err != nil {
+		return false, err
+	}
+	if _, err := runGit(nil, nil, "reset", "--hard", "--quiet"); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// restoreLocalChanges applies the changes set aside by stashLocalChanges.
+// Files changed on both sides are left in conflict, with the local edit as
+// "ours", and a MergeConflictError is returned; localChangesRef is removed
+// once they are resolved.
+func restoreLocalChanges() error {
+	if !refExists(localChangesRef) {
+		return nil
+	}
+	defer InvalidateCache()
+	log, err := runGit(nil, nil, "stash", "apply", localChangesRef)
+	if files, _ := unmergedFiles(); len(files) > 0 {
+		return &MergeConflictError{Files: files}
+	}
+	if err != nil {
+		fmt.Printf("[Git] Failed to restore local changes: %v\n%s\n", err, log)
+		if shelveErr := shelveLocalChanges(); shelveErr != nil {
+			return shelveErr
+		}
+		return fmt.Errorf("failed to restore local changes, they were moved to the git stash list: %w", err)
+	}
+	// Additions come back staged; like other edits they stay unstaged
+	runGit(nil, nil, "reset", "--quiet")
+	_, err = runGit(nil, nil, "update-ref", "-d", localChangesRef)
+	return err
+}
+
+// shelveLocalChanges moves localChangesRef to the git stash list, so local
+// changes that can't be restored aren't lost.
+func shelveLocalChanges() error {
+	stash, err := runGit(nil, nil, "rev-parse", localChangesRef)
+	if err != nil {
+		return err
+	}
+	if _, err := runGit(nil, nil, "stash", "store", "-m", "Local changes during sync", strings.TrimSpace(stash)); err != nil {
+		return err
+	}
+	_, err = runGit(nil, nil, "update-ref", "-d", localChangesRef)
+	return err
+}
+
+// conflictStages returns the index stages of our and their side. Applying
+// local changes puts the merged tree in stage 2 and the local edit in 3,
+// the reverse of a merge, so the sides are swapped to keep "ours" local.
+func conflictStages() (ours, theirs int) {
+	if restoringLocalChanges() {
+		return 3, 2
+	}
+	return 2, 3
+}
+
+func unmergedFiles() ([]string, error) {
+	out, err := runGit(nil, nil, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+func conflictVersion(stage int, path string) models.ConflictVersion {
+	out, err := runGit(nil, nil, "show", fmt.Sprintf(":%d:%s", stage, path))
+	if err != nil {
+		return models.ConflictVersion{} // Side deleted or not present (e.g. add/add has no base)
+	}
+
+	version := models.ConflictVersion{Exists: true, Content: out}
+	if strings.HasPrefix(path, "content/") {
+		if fm, body, format, err := ParseFrontMatter([]byte(out)); err == nil {
+			version.FrontMatter = fm
+			version.Body = body
+			version.Format = format
+		}
+	}
+	return version
+}
+
+// ListConflicts returns base/ours/theirs versions of every unmerged file.
+func ListConflicts() ([]models.Conflict, error) {
+	if !IsMerging() {
+		return []models.Conflict{}, nil
+	}
+	files, err := unmergedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	ours, theirs := conflictStages()
+	conflicts := []models.Conflict{}
+	for _, file := range files {
+		conflicts = append(conflicts, models.Conflict{
+			Path:   file,
+			Base:   conflictVersion(1, file),
+			Ours:   conflictVersion(ours, file),
+			Theirs: conflictVersion(theirs, file),
+		})
+	}
+	return conflicts, nil
+}
+
+// ResolveConflict resolves a single unmerged file. For manual resolutions
+// content is the merged file; it is ignored otherwise. Once the last conflict
+// is resolved the merge commit is created and (true, nil) is returned.
+func ResolveConflict(path, resolution string, content []byte, author *models.GitUser) (bool, error) {
+	files, err := unmergedFiles()
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, file := range files {
+		if file == path {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("%s is not in conflict", path)
+	}
+
+	fullPath := SafeJoin(config.RepoPath, "", path)
+	if fullPath == "" {
+		return false, fmt.Errorf("invalid path")
+	}
+
+	switch resolution {
+	case ResolveOurs, ResolveTheirs:
+		stage, _ := conflictStages()
+		if resolution == ResolveTheirs {
+			_, stage = conflictStages()
+		}
+		if !conflictVersion(stage, path).Exists {
+			// The chosen side deleted the file
+			if _, err := runGit(nil, nil, "rm", "--quiet", "--", path); err != nil {
+				return false, err
+			}
+			break
+		}
+		side := "--ours"
+		if stage == 3 {
+			side = "--theirs"
+		}
+		if _, err := runGit(nil, nil, "checkout", side, "--", path); err != nil {
+			return false, err
+		}
+		if _, err := runGit(nil, nil, "add", "--", path); err != nil {
+			return false, err
+		}
+	case ResolveManual:
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(fullPath, content, 0644); err != nil {
+			return false, err
+		}
+		if _, err := runGit(nil, nil, "add", "--", path); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("unknown resolution: %s", resolution)
+	}
+
+	remaining, err := unmergedFiles()
+	if err != nil || len(remaining) > 0 {
+		return false, err
+	}
+	err = completeMerge(author)
+	var conflictErr *MergeConflictError
+	if errors.As(err, &conflictErr) {
+		return false, nil // Local changes conflict with the merge result
+	}
+	return err == nil, err
+}
+
+// completeMerge commits the resolved merge and applies the local changes
+// set aside for it. Resolved local changes stay uncommitted.
+func completeMerge(author *models.GitUser) error {
+	if restoringLocalChanges() {
+		defer InvalidateCache()
+		if _, err := runGit(nil, nil, "reset", "--quiet"); err != nil {
+			return err
+		}
+		_, err := runGit(nil, nil, "update-ref", "-d", localChangesRef)
+		return err
+	}
+	if _, err := runGit(commitIdentityEnv(author), nil, "commit", "--no-edit"); err != nil {
+		return err
+	}
+	InvalidateCache()
+	return restoreLocalChanges()
+}
+
+// AbortMerge throws away an in-progress merge and restores the pre-sync
+// state. Local changes that conflict with a completed merge can't be
+// applied; they are moved to the git stash list instead.
+func AbortMerge() error {
+	if !IsMerging() {
+		return fmt.Errorf("no merge in progress")
+	}
+	defer InvalidateCache()
+	if restoringLocalChanges() {
+		if _, err := runGit(nil, nil, "reset", "--hard", "--quiet"); err != nil {
+			return err
+		}
+		return shelveLocalChanges()
+	}
+	if _, err := runGit(nil, nil, "merge", "--abort"); err != nil {
+		return err
+	}
+	return restoreLocalChanges()
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"hugo-cms/pkg/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Extensions of the content formats Hugo renders
+var hugoContentExtensions = []string{
+	"md", "markdown", "mdown", // Markdown
+	"html", "htm", // HTML
+	"adoc", "asciidoc", "ad", // AsciiDoc
+	"org",           // Emacs Org Mode
+	"rst",           // reStructuredText
+	"pandoc", "pdc", // Pandoc
+}
+
+var (
+	contentExtMu      sync.Mutex
+	contentExts       map[string]bool
+	contentExtModTime time.Time // Of the CMS config contentExts was built from
+)
+
+// contentExtensions returns the lowercased extensions, without the dot, of
+// the files treated as articles: Hugo's content formats plus the extension
+// of every collection in the CMS config.
+func contentExtensions() map[string]bool {
+	var modTime time.Time
+	if info, err := os.Stat(filepath.Join(config.RepoPath, "static/admin/config.yml")); err == nil {
+		modTime = info.ModTime()
+	}
+
+	contentExtMu.Lock()
+	defer contentExtMu.Unlock()
+	if contentExts != nil && modTime.Equal(contentExtModTime) {
+		return contentExts
+	}
+
+	exts := map[string]bool{}
+	for _, ext := range hugoContentExtensions {
+		exts[ext] = true
+	}
+	if cfg, err := GetCMSConfig(); err == nil {
+		for _, col := range cfg.Collections {
+			if ext := strings.ToLower(strings.TrimPrefix(col.Extension, ".")); ext != "" {
+				exts[ext] = true
+			}
+		}
+	}
+	contentExts, contentExtModTime = exts, modTime
+	return exts
+}
+
+// contentFormats is the set of content extensions resolved once, so walks
+// and batches don't stat the CMS config and take contentExtMu per file.
+type contentFormats map[string]bool
+
+func currentContentFormats() contentFormats {
+	return contentFormats(contentExtensions())
+}
+
+// hasExtension reports whether name has the extension of a content format.
+func (f contentFormats) hasExtension(name string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	return ext != "" && f[ext]
+}
+
+// isContent reports whether the file at fullPath is an article. An HTML file
+// must start with front matter, as bundles also hold plain HTML resources.
+func (f contentFormats) isContent(fullPath string) bool {
+	if !f.hasExtension(fullPath) {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(fullPath)) {
+	case ".html", ".htm":
+		return startsWithFrontMatter(fullPath)
+	}
+	return true
+}
+
+// isContentPage is isContent for a repo-relative path below content/.
+func (f contentFormats) isContentPage(repoPath string) bool {
+	return strings.HasPrefix(repoPath, "content/") && f.isContent(filepath.Join(config.RepoPath, filepath.FromSlash(repoPath)))
+}
+
+// startsWithFrontMatter reports whether the file at fullPath opens with a
+// front matter delimiter. A deleted file is judged by its HEAD version.
+func startsWithFrontMatter(fullPath string) bool {
+	head := make([]byte, 512)
+	f, err := os.Open(fullPath)
+	if err == nil {
+		n, _ := f.Read(head)
+		f.Close()
+		head = head[:n]
+	} else {
+		rel, relErr := filepath.Rel(config.RepoPath, fullPath)
+		if relErr != nil {
+			return false
+		}
+		if head, err = GetGitBackend().ShowHead(filepath.ToSlash(rel)); err != nil {
+			return false
+		}
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\uFEFF")), " \t\r\n")
+	for _, delim := range []string{"---", "+++", "{"} {
+		if bytes.HasPrefix(head, []byte(delim)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBundleIndex reports whether path is the index file of a leaf bundle
+// (index.md, index.org, ...), which owns the other files of its directory.
+func isBundleIndex(path string) bool {
+	return currentContentFormats().isBundleIndex(path)
+}
+
+func (f contentFormats) isBundleIndex(path string) bool {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name)) == "index" && f.hasExtension(name)
+}
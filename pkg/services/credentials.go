@@ -0,0 +1,274 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credential modes for remote git operations (config.GitAuthMode).
+const (
+	AuthOAuth     = "oauth"      // The logged-in editor's OAuth token
+	AuthGitHubApp = "github_app" // A GitHub App installation token
+	AuthDeployKey = "deploy_key" // An SSH deploy key
+)
+
+var (
+	appTokenMu      sync.Mutex
+	appToken        string
+	appTokenExpires time.Time
+)
+
+// RepoToken returns the token for remote git operations and repository API
+// calls. Only in OAuth mode is this the editor's own token; otherwise the
+// server credential is used regardless of who is logged in.
+func RepoToken(userToken string) (string, error) {
+	switch config.GitAuthMode {
+	case AuthGitHubApp:
+		return installationToken()
+	case AuthDeployKey:
+		return "", nil // Git authenticates over SSH
+	default:
+		return userToken, nil
+	}
+}
+
+// ServerToken returns the credential for git operations that are not made
+// on behalf of a logged-in editor.
+func ServerToken() string {
+	if config.GitAuthMode == AuthGitHubApp {
+		token, err := installationToken()
+		if err != nil {
+			fmt.Printf("[Auth] Failed to get installation token: %v\n", err)
+		}
+		return token
+	}
+	return config.GitSyncToken
+}
+
+// NewRepoClient returns a GitHub API client authorized for the repository.
+// Deploy keys can't call the API, so that mode uses GIT_SYNC_TOKEN and only
+// without it the editor's token.
+func NewRepoClient(userToken string) (*GitHubClient, error) {
+	if config.GitAuthMode == AuthDeployKey {
+		if config.GitSyncToken != "" {
+			return NewGitHubClient(config.GitSyncToken), nil
+		}
+		return NewGitHubClient(userToken), nil
+	}
+	token, err := RepoToken(userToken)
+	if err != nil {
+		return nil, err
+	}
+	return NewGitHubClient(token), nil
+}
+
+// tokenUsername is the HTTPS user name that goes with a RepoToken.
+func tokenUsername() string {
+	if config.GitAuthMode == AuthGitHubApp {
+		return "x-access-token"
+	}
+	return "oauth2"
+}
+
+// sshCommand returns GIT_SSH_COMMAND for the deploy key.
+func sshCommand() string {
+	cmd := "ssh -i " + shellQuote(config.GitDeployKeyPath) + " -o IdentitiesOnly=yes"
+	if config.GitSSHKnownHosts != "" {
+		cmd += " -o UserKnownHostsFile=" + shellQuote(config.GitSSHKnownHosts) + " -o StrictHostKeyChecking=yes"
+	} else {
+		cmd += " -o StrictHostKeyChecking=accept-new"
+	}
+	return cmd
+}
+
+// shellQuote quotes s for the shell git runs GIT_SSH_COMMAND with. Go's %q
+// leaves $ and backticks open to expansion inside the double quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sshRemoteURL rewrites an http(s) remote to the scp-like SSH form used
+// with deploy keys; other URLs are returned unchanged.
+func sshRemoteURL(remoteURL string) string {
+	u := parseRemoteURL(remoteURL)
+	if u == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return remoteURL
+	}
+	return "git@" + u.Hostname() + ":" + strings.TrimPrefix(u.Path, "/")
+}
+
+// scpRemote matches scp-like remotes such as git@github.com:owner/repo.git.
+// Hosts are at least two characters so Windows drive letters don't match.
+var scpRemote = regexp.MustCompile(`^(?:([^@/:]+)@)?([^@/:]{2,}):(.*)$`)
+
+// parseRemoteURL parses URL and scp-like remotes, which url.Parse rejects
+// or misreads. scp-like remotes come back as ssh:// URLs. Local paths
+// return nil.
+func parseRemoteURL(raw string) *url.URL {
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil
+		}
+		return u
+	}
+	m := scpRemote.FindStringSubmatch(raw)
+	if m == nil {
+		return nil
+	}
+	u := &url.URL{Scheme: "ssh", Host: m[2], Path: "/" + strings.TrimPrefix(m[3], "/")}
+	if m[1] != "" {
+		u.User = url.User(m[1])
+	}
+	return u
+}
+
+// tokenRemoteURL returns the HTTPS URL (without user) a token authenticates
+// against: http(s) remotes as they are, SSH remotes on the same host and
+// path. ok is false for local paths and other transports.
+func tokenRemoteURL(raw string) (*url.URL, bool) {
+	u := parseRemoteURL(raw)
+	if u == nil {
+		return nil, false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		u.User = nil
+		return u, true
+	case "ssh", "git+ssh":
+		return &url.URL{Scheme: "https", Host: u.Hostname(), Path: u.Path}, true
+	}
+	return nil, false
+}
+
+func getRemoteURL(remote string) (string, error) {
+	return GetGitBackend().RemoteURL(remote)
+}
+
+// sameRemoteHost reports whether remoteURL is on the host of config.GitRemote.
+func sameRemoteHost(remoteURL string) bool {
+	primaryURL, err := getRemoteURL(config.GitRemote)
+	if err != nil {
+		return false
+	}
+	primary, other := parseRemoteURL(primaryURL), parseRemoteURL(remoteURL)
+	if primary == nil || other == nil {
+		return primary == nil && other == nil // Both local
+	}
+	return strings.EqualFold(primary.Hostname(), other.Hostname())
+}
+
+// installationToken returns a cached GitHub App installation token,
+// minting a new one shortly before the current one expires.
+func installationToken() (string, error) {
+	appTokenMu.Lock()
+	defer appTokenMu.Unlock()
+
+	if appToken != "" && time.Until(appTokenExpires) > 5*time.Minute {
+		return appToken, nil
+	}
+
+	jwt, err := appJWT()
+	if err != nil {
+		return "", err
+	}
+	client := NewGitHubClient(jwt)
+
+	installationID := config.GitHubAppInstallationID
+	if installationID == "" {
+		owner, repo, err := GetRemoteRepo()
+		if err != nil {
+			return "", err
+		}
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		if err := client.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s/installation", owner, repo), nil, &installation); err != nil {
+			return "", fmt.Errorf("github app is not installed on %s/%s: %w", owner, repo, err)
+		}
+		installationID = fmt.Sprint(installation.ID)
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := client.do(http.MethodPost, "/app/installations/"+installationID+"/access_tokens", nil, &token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		return "", errors.New("github returned an empty installation token")
+	}
+
+	fmt.Printf("[Auth] Minted installation token, expires %v\n", token.ExpiresAt)
+	appToken, appTokenExpires = token.Token, token.ExpiresAt
+	return appToken, nil
+}
+
+// appJWT signs the short-lived RS256 JWT that authenticates as the GitHub App.
+func appJWT() (string, error) {
+	if config.GitHubAppID == "" || config.GitHubAppPrivateKeyPath == "" {
+		return "", errors.New("GITHUB_APP_ID and GITHUB_APP_PRIVATE_KEY_PATH are required for github_app auth")
+	}
+	key, err := loadAppPrivateKey(config.GitHubAppPrivateKeyPath)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(), // Allow for clock drift
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": config.GitHubAppID,
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func loadAppPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	// GitHub issues PKCS#1 keys; PKCS#8 is accepted for converted keys
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not RSA", path)
+	}
+	return key, nil
+}
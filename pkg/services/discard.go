@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Discard actions reported by DiscardChanges.
+const (
+	DiscardRestored = "restored" // Reset to HEAD
+	DiscardRemoved  = "removed"  // Untracked or newly added file deleted
+)
+
+// DiscardTarget maps a content-relative article path to the repo-relative
+// path to discard: the whole directory for leaf bundles, otherwise the file.
+func DiscardTarget(relPath string) string {
+	repoRel := filepath.ToSlash(filepath.Join("content", relPath))
+	if isBundleIndex(relPath) {
+		return filepath.ToSlash(filepath.Dir(repoRel))
+	}
+	return repoRel
+}
+
+// DiscardChanges resets the given repo-relative files or directories to HEAD,
+// deleting files that don't exist there. With dryRun nothing is touched and
+// the returned list describes what would happen.
+func DiscardChanges(targets []string, dryRun bool) ([]models.DiscardedFile, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[Discard] Targets: %v, DryRun: %v, Duration: %v\n", targets, dryRun, time.Since(start))
+	}()
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("nothing to discard")
+	}
+	for _, target := range targets {
+		if SafeJoin(config.RepoPath, "", target) == "" || !(strings.HasPrefix(target, "content/") || strings.HasPrefix(target, "static/")) {
+			return nil, fmt.Errorf("invalid path: %s", target)
+		}
+	}
+
+	changes, err := statusChanges(targets...)
+	if err != nil {
+		return nil, err
+	}
+
+	discarded := []models.DiscardedFile{}
+	for _, change := range changes {
+		if change.OldPath != "" {
+			// Undo a staged rename: bring back the source, drop the destination
+			discarded = append(discarded, models.DiscardedFile{Path: change.OldPath, Action: DiscardRestored})
+		}
+		action := DiscardRestored
+		if !refExists("HEAD:" + change.Path) {
+			action = DiscardRemoved
+		}
+		discarded = append(discarded, models.DiscardedFile{Path: change.Path, Action: action})
+	}
+
+	if dryRun {
+		return discarded, nil
+	}
+
+	for _, file := range discarded {
+		if file.Action == DiscardRestored {
+			if _, err := runGit(nil, nil, "checkout", "HEAD", "--", file.Path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Unstage first in case it was added to the index
+		runGit(nil, nil, "rm", "--cached", "--quiet", "--ignore-unmatch", "--", file.Path)
+		fullPath := filepath.Join(config.RepoPath, filepath.FromSlash(file.Path))
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		removeEmptyParents(filepath.Dir(fullPath))
+	}
+
+	formats := currentContentFormats()
+	for _, file := range discarded {
+		if formats.isContentPage(file.Path) {
+			UpdateCache(strings.TrimPrefix(file.Path, "content/"))
+		}
+	}
+	return discarded, nil
+}
+
+// removeEmptyParents deletes empty directories left behind by discarded files,
+// stopping at top-level folders such as content/posts or static/images.
+func removeEmptyParents(dir string) {
+	for {
+		rel, err := filepath.Rel(config.RepoPath, dir)
+		if err != nil || strings.Count(filepath.ToSlash(rel), "/") < 2 {
+			return
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
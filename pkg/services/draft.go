@@ -0,0 +1,470 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrDraftPreviewDisabled = errors.New("draft previews are disabled")
+
+const (
+	// How long an update waits for hugo to re-render the draft
+	draftRebuildTimeout = 5 * time.Second
+	// How long the first update waits for a new server's initial build
+	draftStartTimeout = 30 * time.Second
+)
+
+// draftPreview renders one editor session's unsaved content. Its content
+// directory mirrors RepoPath/content with hard links, except for the
+// article being edited, which holds the posted draft; everything else
+// (config, layouts, themes) comes from RepoPath itself via --contentDir.
+// The mirror is built once; later changes arrive from the file watcher.
+type draftPreview struct {
+	id       string
+	dir      string
+	port     int
+	server   *ProcessSupervisor
+	proxy    *httputil.ReverseProxy
+	rebuilt  chan struct{}
+	mu       sync.Mutex // Serializes updates of the content directory
+	override string     // Content-relative path holding the draft
+	stale    bool       // The mirror missed changes and is synced again
+	lastUsed time.Time
+}
+
+var (
+	draftsMu      sync.Mutex
+	drafts        = map[string]*draftPreview{}
+	draftsJanitor sync.Once
+)
+
+func draftsDir() string {
+	return filepath.Join(config.CMSDataDir, "drafts")
+}
+
+// NewDraftPreviewID returns a random id for an editor session's drafts.
+func NewDraftPreviewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// UpdateDraftPreview renders content as contentPath in the draft preview
+// of session id, starting its hugo server if needed, and returns where the
+// draft can be viewed. RepoPath is not written to.
+func UpdateDraftPreview(id, contentPath string, content []byte) (preview models.PreviewURL, err error) {
+	target := SafeJoin(config.RepoPath, "content", contentPath)
+	if target == "" {
+		return models.PreviewURL{}, fmt.Errorf("invalid path: %s", contentPath)
+	}
+	preview, err = resolvePreviewURL(contentPath, content)
+	if err != nil {
+		return models.PreviewURL{}, err
+	}
+
+	d, created, err := getDraftPreview(id)
+	if err != nil {
+		return models.PreviewURL{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if created {
+		// Discarded again if the first update fails
+		defer func() {
+			if err != nil {
+				go DiscardDraftPreview(id)
+			}
+		}()
+	}
+
+	rel := filepath.ToSlash(filepath.Clean(contentPath))
+	src, dst := filepath.Join(config.RepoPath, "content"), filepath.Join(d.dir, "content")
+	switch {
+	case created || d.stale:
+		if err = syncOverlay(src, dst, rel); err != nil {
+			return models.PreviewURL{}, fmt.Errorf("failed to prepare draft content: %w", err)
+		}
+		d.stale = false
+	case d.override != "" && d.override != rel:
+		// The editor moved on; the previous article reverts to its saved content
+		os.Remove(filepath.Join(dst, filepath.FromSlash(d.override)))
+		if err = syncOverlayFile(src, dst, d.override); err != nil {
+			return models.PreviewURL{}, fmt.Errorf("failed to prepare draft content: %w", err)
+		}
+	}
+	d.override = rel
+
+	// Drop a stale rebuild signal, then replace the hard link with a new
+	// file: writing through the link would change the working tree
+	select {
+	case <-d.rebuilt:
+	default:
+	}
+	draftFile := filepath.Join(d.dir, "content", filepath.FromSlash(rel))
+	os.Remove(draftFile)
+	if err = os.MkdirAll(filepath.Dir(draftFile), 0755); err != nil {
+		return models.PreviewURL{}, err
+	}
+	if err = os.WriteFile(draftFile, content, 0644); err != nil {
+		return models.PreviewURL{}, err
+	}
+
+	timeout := draftRebuildTimeout
+	if created {
+		// Started only now, so the first build already includes the draft
+		fmt.Printf("[Draft] Starting preview %s on :%d\n", id[:8], d.port)
+		d.server.Start()
+		timeout = draftStartTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	select {
+	case <-d.rebuilt:
+	case <-time.After(timeout):
+		fmt.Printf("[Draft] %s: no rebuild within %v\n", id[:8], timeout)
+	}
+	if created {
+		// hugo reports the first build before it listens
+		for time.Now().Before(deadline) {
+			if conn, err := net.DialTimeout("tcp", d.server.Addr, time.Second); err == nil {
+				conn.Close()
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	preview.URL = config.DraftPreviewURL + id + preview.Path
+	return preview, nil
+}
+
+// DraftPreviewsEnabled reports whether draft previews can be started.
+func DraftPreviewsEnabled() bool {
+	if config.DraftPreviewMax <= 0 {
+		return false
+	}
+	_, err := exec.LookPath("hugo")
+	return err == nil
+}
+
+// getDraftPreview returns the draft preview of id, creating one if needed.
+// The server of a new preview (created is true) is not started yet.
+func getDraftPreview(id string) (*draftPreview, bool, error) {
+	if config.DraftPreviewMax <= 0 {
+		return nil, false, ErrDraftPreviewDisabled
+	}
+	if _, err := exec.LookPath("hugo"); err != nil {
+		return nil, false, fmt.Errorf("failed to start draft preview: %w", err)
+	}
+	draftsJanitor.Do(func() {
+		// Left over from a previous run
+		os.RemoveAll(draftsDir())
+		go expireDraftPreviews()
+	})
+
+	draftsMu.Lock()
+	if d, ok := drafts[id]; ok {
+		d.lastUsed = time.Now()
+		draftsMu.Unlock()
+		return d, false, nil
+	}
+
+	// At the limit, the least recently used preview makes room
+	var evicted *draftPreview
+	if len(drafts) >= config.DraftPreviewMax {
+		for _, d := range drafts {
+			if evicted == nil || d.lastUsed.Before(evicted.lastUsed) {
+				evicted = d
+			}
+		}
+		delete(drafts, evicted.id)
+	}
+	port := config.DraftPreviewPort
+	if evicted != nil {
+		port = evicted.port
+	} else {
+		for draftPortInUse(port) {
+			port++
+		}
+	}
+	d := newDraftPreview(id, port)
+	drafts[id] = d
+	draftsMu.Unlock()
+
+	if evicted != nil {
+		fmt.Printf("[Draft] Stopping %s to make room\n", evicted.id[:8])
+		evicted.stop()
+	}
+	return d, true, nil
+}
+
+// draftPortInUse reports whether a draft preview uses port. Called with
+// draftsMu held.
+func draftPortInUse(port int) bool {
+	for _, d := range drafts {
+		if d.port == port {
+			return true
+		}
+	}
+	return false
+}
+
+func newDraftPreview(id string, port int) *draftPreview {
+	d := &draftPreview{
+		id:       id,
+		dir:      filepath.Join(draftsDir(), id),
+		port:     port,
+		rebuilt:  make(chan struct{}, 1),
+		lastUsed: time.Now(),
+	}
+	os.RemoveAll(d.dir)
+	// hugo resolves a relative --contentDir against --source
+	contentDir, _ := filepath.Abs(filepath.Join(d.dir, "content"))
+
+	addr := net.JoinHostPort(config.HugoServerBind, strconv.Itoa(port))
+	target, _ := url.Parse("http://" + addr)
+	d.proxy = httputil.NewSingleHostReverseProxy(target)
+	d.proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "Draft preview is starting, please retry in a moment.", http.StatusServiceUnavailable)
+	}
+
+	d.server = NewProcessSupervisor("Draft "+id[:8], addr, config.HugoLogLines, func() *exec.Cmd {
+		return exec.Command("hugo", "server",
+			"--source", config.RepoPath,
+			"--contentDir", contentDir,
+			"--bind", config.HugoServerBind,
+			"--port", strconv.Itoa(port),
+			"--baseURL", config.GetAppURL()+config.DraftPreviewURL+id+"/",
+			"--appendPort=false",
+			"--disableLiveReload",
+			"-D",
+			"-F",
+		)
+	})
+	d.server.OnLine = func(line string) {
+		if ParseHugoLine(HugoSourceServer, line).Type == HugoEventBuildDone {
+			select {
+			case d.rebuilt <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return d
+}
+
+func (d *draftPreview) stop() {
+	if d.server != nil {
+		d.server.Stop()
+	}
+	os.RemoveAll(d.dir)
+}
+
+// DraftPreviewHandler returns the proxy to the draft preview server of id.
+func DraftPreviewHandler(id string) (http.Handler, bool) {
+	draftsMu.Lock()
+	defer draftsMu.Unlock()
+	d, ok := drafts[id]
+	if !ok || d.proxy == nil {
+		return nil, false
+	}
+	d.lastUsed = time.Now()
+	return d.proxy, true
+}
+
+// DiscardDraftPreview stops the draft preview of id and deletes its content.
+func DiscardDraftPreview(id string) {
+	draftsMu.Lock()
+	d, ok := drafts[id]
+	delete(drafts, id)
+	draftsMu.Unlock()
+	if ok {
+		d.stop()
+	}
+}
+
+// StopDraftPreviews stops all draft previews, e.g. on shutdown.
+func StopDraftPreviews() {
+	draftsMu.Lock()
+	all := drafts
+	drafts = map[string]*draftPreview{}
+	draftsMu.Unlock()
+	for _, d := range all {
+		d.stop()
+	}
+}
+
+func expireDraftPreviews() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		var expired []*draftPreview
+		draftsMu.Lock()
+		for id, d := range drafts {
+			if time.Since(d.lastUsed) > config.DraftPreviewIdle {
+				expired = append(expired, d)
+				delete(drafts, id)
+			}
+		}
+		draftsMu.Unlock()
+		for _, d := range expired {
+			fmt.Printf("[Draft] Stopping idle preview %s\n", d.id[:8])
+			d.stop()
+		}
+	}
+}
+
+// syncDraftPreviews applies changes of the watched paths (repo relative)
+// below content/ to the draft previews, except to their drafts. Without
+// the watcher, previews see files saved in place through their hard links.
+func syncDraftPreviews(paths []string) {
+	draftsMu.Lock()
+	previews := make([]*draftPreview, 0, len(drafts))
+	for _, d := range drafts {
+		previews = append(previews, d)
+	}
+	draftsMu.Unlock()
+
+	src := filepath.Join(config.RepoPath, "content")
+	for _, d := range previews {
+		d.mu.Lock()
+		for _, path := range paths {
+			rel, ok := strings.CutPrefix(path, "content/")
+			if path == "content" {
+				d.stale = true
+			}
+			if !ok || rel == d.override {
+				continue
+			}
+			if err := syncOverlayFile(src, filepath.Join(d.dir, "content"), rel); err != nil {
+				fmt.Printf("[Draft] %s: failed to sync %s: %v\n", d.id[:8], rel, err)
+				d.stale = true
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// markDraftPreviewsStale makes the next update of every draft preview sync
+// its whole content directory, e.g. after the watcher lost events.
+func markDraftPreviewsStale() {
+	draftsMu.Lock()
+	previews := make([]*draftPreview, 0, len(drafts))
+	for _, d := range drafts {
+		previews = append(previews, d)
+	}
+	draftsMu.Unlock()
+	for _, d := range previews {
+		d.mu.Lock()
+		d.stale = true
+		d.mu.Unlock()
+	}
+}
+
+// syncOverlay mirrors src into dst with hard links, so files saved in place
+// are seen without copying. Files replaced in src (e.g. by git) are linked
+// again, removed ones deleted. The content-relative path keep is left alone.
+// Where hard links are not possible (another file system), files are copied.
+func syncOverlay(src, dst, keep string) error {
+	seen := map[string]bool{}
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() || filepath.ToSlash(rel) == keep {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return linkOverlayFile(path, target, info)
+	})
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dst, path)
+		if rel == "." || seen[rel] || filepath.ToSlash(rel) == keep {
+			return nil
+		}
+		stale = append(stale, path)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	for _, path := range stale {
+		os.RemoveAll(path)
+	}
+	return nil
+}
+
+// syncOverlayFile mirrors the path rel (slash separated, relative to src)
+// into dst: linked if it is a file, removed if it no longer exists.
+func syncOverlayFile(src, dst, rel string) error {
+	path := filepath.Join(src, filepath.FromSlash(rel))
+	target := filepath.Join(dst, filepath.FromSlash(rel))
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return os.RemoveAll(target)
+	case err != nil:
+		return err
+	case info.IsDir():
+		return os.MkdirAll(target, 0755)
+	case !info.Mode().IsRegular():
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return linkOverlayFile(path, target, info)
+}
+
+// linkOverlayFile hard links path (described by info) to target unless
+// target already mirrors it, copying where links are not possible.
+func linkOverlayFile(path, target string, info fs.FileInfo) error {
+	if existing, err := os.Lstat(target); err == nil {
+		if os.SameFile(info, existing) || (existing.Size() == info.Size() && existing.ModTime().Equal(info.ModTime())) {
+			return nil
+		}
+		os.Remove(target)
+	}
+	if err := os.Link(path, target); err == nil {
+		return nil
+	}
+	if err := copyFile(path, target); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
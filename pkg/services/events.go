@@ -0,0 +1,196 @@
+package services
+
+import (
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hugo event types.
+const (
+	HugoEventLog        = "log"
+	HugoEventError      = "error"
+	HugoEventWarn       = "warn"
+	HugoEventBuildStart = "build_start"
+	HugoEventBuildDone  = "build_done"
+)
+
+// Hugo event sources.
+const (
+	HugoSourceServer = "server"
+	HugoSourceBuild  = "build"
+)
+
+// Events buffered per subscriber; a client that falls further behind misses lines
+const eventBufferSize = 256
+
+var (
+	// hugo reports positions as "/path/to/file.md:12:3" (quoted in current versions)
+	quotedPosition = regexp.MustCompile(`"([^"]+?):(\d+)(?::(\d+))?"`)
+	plainPosition  = regexp.MustCompile(`(\S+\.\w+):(\d+)(?::(\d+))?`)
+)
+
+// eventHub fans events out to the SSE streams of connected browsers.
+type eventHub[T any] struct {
+	mu     sync.Mutex
+	subs   map[chan T]struct{}
+	closed bool
+}
+
+func newEventHub[T any]() *eventHub[T] {
+	return &eventHub[T]{subs: make(map[chan T]struct{})}
+}
+
+// subscribe returns a stream starting with replay and a function that ends
+// the subscription. Called with h.mu held.
+func (h *eventHub[T]) subscribe(replay []T) (<-chan T, func()) {
+	ch := make(chan T, eventBufferSize)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	for _, ev := range replay {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	h.subs[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends ev to all subscribers. Called with h.mu held.
+func (h *eventHub[T]) publish(ev T) {
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default: // Never let a slow client block the publisher
+		}
+	}
+}
+
+func (h *eventHub[T]) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+var (
+	hugoEvents = newEventHub[models.HugoEvent]()
+	// Errors and warnings of each source's current build, so a client that
+	// connects later still learns about them. Guarded by hugoEvents.mu.
+	hugoIssues = map[string][]models.HugoEvent{}
+)
+
+// SubscribeHugoEvents returns a stream of hugo events, starting with the
+// issues of the current builds, and a function that ends the subscription.
+// The channel is closed by CloseEventStreams.
+func SubscribeHugoEvents() (<-chan models.HugoEvent, func()) {
+	hugoEvents.mu.Lock()
+	defer hugoEvents.mu.Unlock()
+	var replay []models.HugoEvent
+	for _, source := range []string{HugoSourceServer, HugoSourceBuild} {
+		replay = append(replay, hugoIssues[source]...)
+	}
+	return hugoEvents.subscribe(replay)
+}
+
+// CloseEventStreams ends all event streams, e.g. on shutdown.
+func CloseEventStreams() {
+	hugoEvents.close()
+	fileEvents.close()
+}
+
+func publishHugoEvent(ev models.HugoEvent) {
+	hugoEvents.mu.Lock()
+	defer hugoEvents.mu.Unlock()
+
+	switch ev.Type {
+	case HugoEventBuildStart:
+		hugoIssues[ev.Source] = nil
+	case HugoEventError, HugoEventWarn:
+		hugoIssues[ev.Source] = append(hugoIssues[ev.Source], ev)
+	}
+	hugoEvents.publish(ev)
+}
+
+// hugoLineHandler returns a line callback that publishes output of source.
+func hugoLineHandler(source string) func(string) {
+	return func(line string) {
+		publishHugoEvent(ParseHugoLine(source, line))
+	}
+}
+
+// ParseHugoLine classifies one line of hugo output. Errors and warnings get
+// the file and position hugo reported; files below content/ also get their
+// content-relative Path so the UI can point at the article.
+func ParseHugoLine(source, line string) models.HugoEvent {
+	ev := models.HugoEvent{Type: HugoEventLog, Source: source, Message: line, Time: time.Now()}
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(trimmed, "ERROR") || strings.HasPrefix(trimmed, "Error:"):
+		ev.Type = HugoEventError
+	case strings.HasPrefix(trimmed, "WARN"):
+		ev.Type = HugoEventWarn
+	case strings.HasPrefix(trimmed, "Start building sites") || strings.HasPrefix(trimmed, "Change detected, rebuilding site"):
+		ev.Type = HugoEventBuildStart
+	case strings.HasPrefix(trimmed, "Total in") || strings.HasPrefix(trimmed, "Built in"):
+		ev.Type = HugoEventBuildDone
+	}
+	if ev.Type != HugoEventError && ev.Type != HugoEventWarn {
+		return ev
+	}
+
+	m := quotedPosition.FindStringSubmatch(trimmed)
+	if m == nil {
+		m = plainPosition.FindStringSubmatch(trimmed)
+	}
+	if m == nil {
+		return ev
+	}
+	ev.File = m[1]
+	ev.Line, _ = strconv.Atoi(m[2])
+	ev.Column, _ = strconv.Atoi(m[3])
+	ev.Path = contentPathOf(ev.File)
+	return ev
+}
+
+// contentPathOf maps a file reported by hugo to its content-relative path,
+// or "" if it is not below content/.
+func contentPathOf(file string) string {
+	file = filepath.FromSlash(file)
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(config.RepoPath, file)
+	}
+	contentDir, err := filepath.Abs(filepath.Join(config.RepoPath, "content"))
+	if err != nil {
+		return ""
+	}
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(contentDir, file)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
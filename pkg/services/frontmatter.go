@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"hugo-cms/pkg/models"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,6 +36,12 @@ func ParseFrontMatter(content []byte) (map[string]interface{}, string, string, e
 			}
 		}
 	}
+	// Check for Org Mode (#+KEY: value)
+	if strings.HasPrefix(str, "#+") {
+		if fm, body, ok := parseOrgFrontMatter(str); ok {
+			return fm, body, "org", nil
+		}
+	}
 	// Check for JSON ({)
 	if strings.HasPrefix(strings.TrimSpace(str), "{") {
 		var fm map[string]interface{}
@@ -75,6 +83,10 @@ func ConstructFileContent(fm map[string]interface{}, body string, format string)
 			return nil, err
 		}
 		return buf.Bytes(), nil
+	case "org":
+		if err := writeOrgFrontMatter(&buf, normalizedFM); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -88,6 +100,119 @@ func ConstructFileContent(fm map[string]interface{}, body string, format string)
 	return buf.Bytes(), nil
 }
 
+var (
+	// An Org Mode keyword line; "#+TAGS[]: a b" holds a list
+	orgKeyword = regexp.MustCompile(`^#\+([A-Za-z0-9_-]+)(\[\])?:\s*(.*?)\s*$`)
+	// An Org Mode timestamp such as <2024-01-02 Tue> or [2024-01-02 Tue 10:00]
+	orgTimestamp = regexp.MustCompile(`^[<\[](\d{4}-\d{2}-\d{2})(?: [^>\]]*)?[>\]]$`)
+)
+
+// parseOrgFrontMatter reads the keyword lines at the top of an Org Mode
+// file the way Hugo does: keys are lowercased, "KEY[]" values and repeated
+// keywords become lists, FILETAGS is split at colons and timestamps of the
+// date fields are reduced to their date.
+func parseOrgFrontMatter(str string) (map[string]interface{}, string, bool) {
+	fm := map[string]interface{}{}
+	lines := strings.SplitAfter(str, "\n")
+	n := 0
+	for ; n < len(lines); n++ {
+		m := orgKeyword.FindStringSubmatch(strings.TrimRight(lines[n], "\r\n"))
+		if m == nil {
+			break
+		}
+		key, value := strings.ToLower(m[1]), m[3]
+		switch {
+		case m[2] != "":
+			fm[key] = orgList(strings.Fields(value))
+		case key == "filetags":
+			fm[key] = orgList(strings.FieldsFunc(value, func(r rune) bool { return r == ':' }))
+		default:
+			if ts := orgTimestamp.FindStringSubmatch(value); ts != nil && isDateParam(key) {
+				value = ts[1]
+			}
+			switch prev := fm[key].(type) {
+			case nil:
+				fm[key] = value
+			case []interface{}:
+				fm[key] = append(prev, value)
+			default:
+				fm[key] = []interface{}{prev, value}
+			}
+		}
+	}
+	if n == 0 {
+		return nil, "", false
+	}
+	return fm, strings.TrimSpace(strings.Join(lines[n:], "")), true
+}
+
+func orgList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
+
+// writeOrgFrontMatter writes fm as Org Mode keyword lines. Lists are
+// written as "KEY[]" when no item contains a space, otherwise as one line
+// per item; nested fields can't be expressed.
+func writeOrgFrontMatter(buf *bytes.Buffer, fm map[string]interface{}) error {
+	keys := make([]string, 0, len(fm))
+	for key := range fm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ToUpper(key)
+		var items []string
+		switch v := fm[key].(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			return fmt.Errorf("org front matter can't hold nested field %q", key)
+		case []interface{}:
+			for _, item := range v {
+				items = append(items, orgValue(item))
+			}
+		case []string:
+			for _, item := range v {
+				items = append(items, orgValue(item))
+			}
+		default:
+			fmt.Fprintf(buf, "#+%s: %s\n", name, orgValue(v))
+			continue
+		}
+
+		spaced := false
+		for _, item := range items {
+			if item == "" || strings.ContainsAny(item, " \t") {
+				spaced = true
+			}
+		}
+		if spaced {
+			for _, item := range items {
+				fmt.Fprintf(buf, "#+%s: %s\n", name, item)
+			}
+		} else {
+			fmt.Fprintf(buf, "#+%s[]: %s\n", name, strings.Join(items, " "))
+		}
+	}
+	return nil
+}
+
+func orgValue(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		if t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour)) {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339)
+	}
+	s := strings.ReplaceAll(fmt.Sprint(value), "\r\n", " ")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
 func GenerateContentFromCollection(collection models.Collection, overrides map[string]interface{}) ([]byte, error) {
 	fm := make(map[string]interface{})
 	var bodyContent string
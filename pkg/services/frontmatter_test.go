@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOrgFrontMatter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		fm    map[string]interface{}
+		body  string
+		ok    bool
+	}{
+		{"no keywords", "* Heading\nText\n", nil, "", false},
+		{"keywords then body", "#+TITLE: Hello\n#+DRAFT: true\n\n* Heading\n", map[string]interface{}{"title": "Hello", "draft": "true"}, "* Heading", true},
+		{"crlf", "#+TITLE: Hello\r\n\r\nBody\r\n", map[string]interface{}{"title": "Hello"}, "Body", true},
+		{"lowercased keys", "#+Author: Ann\n", map[string]interface{}{"author": "Ann"}, "", true},
+		{"list keyword", "#+TAGS[]: go hugo\n", map[string]interface{}{"tags": []interface{}{"go", "hugo"}}, "", true},
+		{"empty list", "#+TAGS[]:\n", map[string]interface{}{"tags": []interface{}{}}, "", true},
+		{"repeated keyword", "#+AUTHOR: Ann Lee\n#+AUTHOR: Bo Kim\n#+AUTHOR: Cy\n", map[string]interface{}{"author": []interface{}{"Ann Lee", "Bo Kim", "Cy"}}, "", true},
+		{"filetags", "#+FILETAGS: :go:hugo:\n", map[string]interface{}{"filetags": []interface{}{"go", "hugo"}}, "", true},
+		{"date timestamp", "#+DATE: <2024-01-02 Tue 10:00>\n", map[string]interface{}{"date": "2024-01-02"}, "", true},
+		{"inactive timestamp", "#+LASTMOD: [2024-01-02 Tue]\n", map[string]interface{}{"lastmod": "2024-01-02"}, "", true},
+		{"timestamp of other field", "#+EVENT: <2024-01-02 Tue>\n", map[string]interface{}{"event": "<2024-01-02 Tue>"}, "", true},
+		{"stops at first other line", "#+TITLE: A\nText\n#+DRAFT: true\n", map[string]interface{}{"title": "A"}, "Text\n#+DRAFT: true", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, body, ok := parseOrgFrontMatter(tt.input)
+			if ok != tt.ok || body != tt.body || !reflect.DeepEqual(fm, tt.fm) {
+				t.Errorf("parseOrgFrontMatter(%q) = %v, %q, %v; want %v, %q, %v", tt.input, fm, body, ok, tt.fm, tt.body, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWriteOrgFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		fm      map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{"sorted keys", map[string]interface{}{"title": "Hello", "draft": true}, "#+DRAFT: true\n#+TITLE: Hello\n", false},
+		{"nil skipped", map[string]interface{}{"title": "Hello", "summary": nil}, "#+TITLE: Hello\n", false},
+		{"newlines folded", map[string]interface{}{"summary": "one\r\ntwo\nthree"}, "#+SUMMARY: one two three\n", false},
+		{"list", map[string]interface{}{"tags": []interface{}{"go", "hugo"}}, "#+TAGS[]: go hugo\n", false},
+		{"string list", map[string]interface{}{"tags": []string{"go", "hugo"}}, "#+TAGS[]: go hugo\n", false},
+		{"empty list", map[string]interface{}{"tags": []interface{}{}}, "#+TAGS[]: \n", false},
+		{"list with spaces", map[string]interface{}{"authors": []interface{}{"Ann Lee", "Bo"}}, "#+AUTHORS: Ann Lee\n#+AUTHORS: Bo\n", false},
+		{"single item with spaces", map[string]interface{}{"authors": []interface{}{"Ann Lee"}}, "#+AUTHORS: Ann Lee\n", false},
+		{"date", map[string]interface{}{"date": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, "#+DATE: 2024-01-02\n", false},
+		{"date and time", map[string]interface{}{"date": time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)}, "#+DATE: 2024-01-02T10:30:00Z\n", false},
+		{"nested field", map[string]interface{}{"build": map[string]interface{}{"render": "never"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeOrgFrontMatter(&buf, tt.fm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeOrgFrontMatter() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && buf.String() != tt.want {
+				t.Errorf("writeOrgFrontMatter() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// Written front matter parses back to the same values, dates as strings.
+func TestOrgFrontMatterRoundTrip(t *testing.T) {
+	fm := map[string]interface{}{
+		"title":   "Hello: World",
+		"date":    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"tags":    []interface{}{"go", "hugo"},
+		"authors": []interface{}{"Ann Lee", "Bo Kim"},
+		"draft":   false,
+	}
+	var buf bytes.Buffer
+	if err := writeOrgFrontMatter(&buf, fm); err != nil {
+		t.Fatal(err)
+	}
+	got, _, ok := parseOrgFrontMatter(buf.String() + "\nBody\n")
+	want := map[string]interface{}{
+		"title":   "Hello: World",
+		"date":    "2024-01-02",
+		"tags":    []interface{}{"go", "hugo"},
+		"authors": []interface{}{"Ann Lee", "Bo Kim"},
+		"draft":   "false",
+	}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+}
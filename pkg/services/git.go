@@ -2,8 +2,10 @@ package services
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
 	"net/url"
 	"os"
 	"os/exec"
@@ -11,14 +13,18 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	godiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 func CheckSemanticDiff(relPath string) (bool, error) {
 	gitPath := filepath.ToSlash(relPath)
 
-	cmdHead := exec.Command("git", "show", "HEAD:"+gitPath)
-	cmdHead.Dir = config.RepoPath
-	headContent, _ := cmdHead.Output()
+	headContent, _ := GetGitBackend().ShowHead(gitPath)
 
 	diskPath := filepath.Join(config.RepoPath, filepath.FromSlash(gitPath))
 	diskContent, _ := os.ReadFile(diskPath)
@@ -41,7 +47,23 @@ func CheckSemanticDiff(relPath string) (bool, error) {
 	return headBody != diskBody, nil
 }
 
+// ExecuteGitWithToken runs a remote git command against config.GitRemote;
+// see executeGitRemote.
 func ExecuteGitWithToken(dir, token string, args ...string) (string, error) {
+	return executeGitRemote(dir, config.GitRemote, token, commitIdentityEnv(nil), args...)
+}
+
+// executeGitWithTokenEnv is ExecuteGitWithToken with extra environment,
+// e.g. the identity used for merge commits created by pull.
+func executeGitWithTokenEnv(dir, token string, extraEnv []string, args ...string) (string, error) {
+	return executeGitRemote(dir, config.GitRemote, token, extraEnv, args...)
+}
+
+// executeGitRemote runs git with credentials for the named remote. The remote
+// argument of the command (the first non-option argument after the
+// subcommand, e.g. `push <remote> ...`) must be the remote name; it is
+// replaced with the authenticated URL.
+func executeGitRemote(dir, remote, token string, extraEnv []string, args ...string) (string, error) {
 	start := time.Now()
 	defer func() {
 		fmt.Printf("[Git] Cmd: %v, Duration: %v\n", args, time.Since(start))
@@ -51,30 +73,44 @@ func ExecuteGitWithToken(dir, token string, args ...string) (string, error) {
 	// We want to use the token for auth, but via ASKPASS.
 	// We need to ensure the remote URL in the command triggers ASKPASS.
 	// Typically, https://username@host/repo... works, asking for password.
-	
-	cmdGetUrl := exec.Command("git", "remote", "get-url", "origin")
-	cmdGetUrl.Dir = dir
-	outUrl, err := cmdGetUrl.Output()
+	remoteUrl, err := getRemoteURL(remote)
 	if err != nil {
 		return "Failed to get remote url", err
 	}
-	remoteUrl := strings.TrimSpace(string(outUrl))
-	u, err := url.Parse(remoteUrl)
+
+	// GitHub App and deploy key modes ignore the editor's token
+	token, err = RepoToken(token)
 	if err != nil {
-		return "Invalid remote url", err
+		return "Failed to get repository credential", err
+	}
+
+	authenticatedUrl := remoteUrl
+	if remote != config.GitRemote && !sameRemoteHost(remoteUrl) {
+		// The credential belongs to the primary remote's host; a mirror
+		// elsewhere relies on git's own configuration (credential helper, SSH agent)
+		token = ""
+	} else if config.GitAuthMode == AuthDeployKey {
+		authenticatedUrl = sshRemoteURL(remoteUrl)
+		extraEnv = append(extraEnv, "GIT_SSH_COMMAND="+sshCommand())
+	} else if u, ok := tokenRemoteURL(remoteUrl); ok && token != "" {
+		// Set a generic username and remove password to force prompt.
+		// SSH remotes are reached over HTTPS so the token can be used.
+		// Local paths and file:// remotes (e.g. a bare test repo) need no credentials.
+		u.User = url.User(tokenUsername())
+		authenticatedUrl = u.String()
 	}
-	
-	// Set generic username "oauth2" and remove password to force prompt
-	u.User = url.User("oauth2")
-	authenticatedUrl := u.String()
 
 	// 2. Prepare Arguments
 	newArgs := make([]string, len(args))
 	copy(newArgs, args)
-	for i, v := range newArgs {
-		if v == "origin" {
+	for i := 1; i < len(newArgs); i++ {
+		if strings.HasPrefix(newArgs[i], "-") {
+			continue
+		}
+		if newArgs[i] == remote {
 			newArgs[i] = authenticatedUrl
 		}
+		break
 	}
 
 	// 3. Setup ASKPASS
@@ -94,13 +130,17 @@ func ExecuteGitWithToken(dir, token string, args ...string) (string, error) {
 		"GIT_TOKEN="+token,
 		"GIT_TERMINAL_PROMPT=0", // Disable interactive prompt fallback
 	)
+	env = append(env, extraEnv...)
 	cmd.Env = env
 
 	output, err := cmd.CombinedOutput()
-	
+
 	// 5. Sanitize Log
 	// The token is not in args, but might be in verbose output if any.
-	safeLog := strings.ReplaceAll(string(output), token, "***")
+	safeLog := string(output)
+	if token != "" {
+		safeLog = strings.ReplaceAll(safeLog, token, "***")
+	}
 	// Also hide the URL with username just in case user considers it sensitive, though it's generic
 	safeLog = strings.ReplaceAll(safeLog, authenticatedUrl, remoteUrl)
 
@@ -137,134 +177,231 @@ func createAskPassScript() (string, error) {
 	return f.Name(), nil
 }
 
-func SyncRepo(token string) (string, error) {
-	log, err := ExecuteGitWithToken(config.RepoPath, token, "pull", config.GitRemote, config.GitBranch)
-	if err == nil {
-		InvalidateCache()
+func SyncRepo(token string, author *models.GitUser) (string, error) {
+	if IsMerging() {
+		if files, _ := unmergedFiles(); len(files) > 0 || refExists("MERGE_HEAD") {
+			return "A previous sync stopped on conflicts; resolve or abort it first", &MergeConflictError{Files: files}
+		}
+		// Set aside by a sync that was interrupted
+		if err := restoreLocalChanges(); err != nil {
+			return "Failed to restore local changes of a previous sync", err
+		}
 	}
-	return log, err
-}
 
-func PublishChanges(token, path string) (string, error) {
-	// Ensure Git Identity
-	// We set this locally for the repo so it doesn't affect global config
+	// Edits to files the remote changed too would make the merge refuse
+	// to run; they are applied again on the merged tree. The gogit backend
+	// refuses to pull over them instead.
+	var stashed bool
+	if config.GitBackend != "gogit" {
+		var err error
+		if stashed, err = stashLocalChanges(); err != nil {
+			return "Failed to set local changes aside", err
+		}
+	}
 
-	cmdConfigEmail := exec.Command("git", "config", "user.email", config.GitUserEmail)
-	cmdConfigEmail.Dir = config.RepoPath
-	if err := cmdConfigEmail.Run(); err != nil {
-		fmt.Printf("[Git] Warning: failed to set user.email: %v\n", err)
+	log, err := GetGitBackend().Pull(token, author)
+	if err != nil {
+		// Keep the merge paused (not aborted) when it stopped on conflicts,
+		// so the editor can resolve them via /api/conflicts. Local changes
+		// are restored once it completes.
+		if files, _ := unmergedFiles(); len(files) > 0 {
+			InvalidateCache()
+			return log, &MergeConflictError{Files: files}
+		}
+		if stashed {
+			if restoreErr := restoreLocalChanges(); restoreErr != nil {
+				log += "\n" + restoreErr.Error()
+			}
+		}
+		return log, err
+	}
+	InvalidateCache()
+	if err := restoreLocalChanges(); err != nil {
+		return log + "\nLocal changes conflict with the merged files", err
 	}
+	return log, nil
+}
 
-	cmdConfigName := exec.Command("git", "config", "user.name", config.GitUserName)
-	cmdConfigName.Dir = config.RepoPath
-	if err := cmdConfigName.Run(); err != nil {
-		fmt.Printf("[Git] Warning: failed to set user.name: %v\n", err)
+// PublishChanges commits and pushes the given repo-relative paths together with
+// the changed media they reference, or everything when paths is empty.
+// An empty message uses the configured commit templates.
+// A rejected push is retried after rebasing onto the remote branch (see pushWithRetry).
+func PublishChanges(token string, author *models.GitUser, paths []string, message string) (*models.PublishResult, error) {
+	result := &models.PublishResult{Status: "error", Files: []string{}}
+	if IsMerging() {
+		result.Log = "A sync is waiting for conflict resolution"
+		return result, &MergeConflictError{}
 	}
 
 	var filesToAdd []string
-	var msg string
-
-	if path != "" {
-		// Single file publish
-		msg = fmt.Sprintf("Update %s via HomeCMS", path)
-		
-		// Always add static
-		filesToAdd = append(filesToAdd, "static")
-
-		// Check for Page Bundle
-		if strings.HasSuffix(path, "index.md") || strings.HasSuffix(path, "_index.md") {
-			// Add parent directory (bundle root)
-			dir := filepath.Dir(path)
-			filesToAdd = append(filesToAdd, dir)
-		} else {
-			// Just the file
-			filesToAdd = append(filesToAdd, path)
+	msg := message
+	if msg == "" {
+		msg = defaultPublishMessage(paths, author)
+	}
+
+	if len(paths) > 0 {
+		// Selective publish: exactly the chosen files plus their changed media
+		changes, err := ListChanges()
+		if err != nil {
+			result.Log = "Failed to list changes"
+			return result, err
+		}
+		filesToAdd = expandPublishPaths(paths, changes)
+		if len(filesToAdd) == 0 {
+			result.Status = "ok"
+			result.Log = "No changes to publish"
+			return result, nil
 		}
 	} else {
 		// Publish all
 		filesToAdd = []string{"."}
-		msg = fmt.Sprintf("Update via HomeCMS: %s", time.Now().Format("2006-01-02 15:04:05"))
 	}
 
-	// Prepare arguments for git add
-	gitAddArgs := append([]string{"add"}, filesToAdd...)
-	addCmd := exec.Command("git", gitAddArgs...)
-	addCmd.Dir = config.RepoPath
-	if out, err := addCmd.CombinedOutput(); err != nil {
-		return fmt.Sprintf("Git Add Failed: %s\nOutput: %s", err.Error(), string(out)), err
+	// Add also stages deletions
+	backend := GetGitBackend()
+	if err := backend.Add(filesToAdd...); err != nil {
+		result.Log = fmt.Sprintf("Git Add Failed: %s", err.Error())
+		return result, err
 	}
+	result.Files = filesToAdd
 
-	commitCmd := exec.Command("git", "commit", "-m", msg)
-	commitCmd.Dir = config.RepoPath
-	commitOut, commitErr := commitCmd.CombinedOutput()
-
-	commitLog := string(commitOut)
+	var commitPaths []string
+	if len(paths) > 0 {
+		commitPaths = filesToAdd
+	}
+	commitLog, commitErr := backend.Commit(commitMessageFor(msg, author), author, commitPaths)
 	if commitErr != nil {
 		commitLog = fmt.Sprintf("Commit Warning/Error: %s\nOutput: %s", commitErr.Error(), commitLog)
 	}
 
-	pushLog, err := ExecuteGitWithToken(config.RepoPath, token, "push", config.GitRemote, config.GitBranch)
+	if head, err := backend.Head(); err == nil {
+		result.Commit = head
+	}
+
+	pushLog, err := pushWithRetry(token, author, result)
 
 	// Invalidate cache after successful publish to refresh dirty status
 	if err == nil {
 		InvalidateCache()
 	}
 
-	fullLog := fmt.Sprintf("--- Git Add ---\n(Success)\n\n--- Git Commit ---\n%s\n\n--- Git Push ---\n%s", commitLog, pushLog)
-	return fullLog, err
+	result.Log = fmt.Sprintf("--- Git Add ---\n%s\n\n--- Git Commit ---\n%s\n\n--- Git Push ---\n%s", strings.Join(filesToAdd, "\n"), commitLog, pushLog)
+	return result, err
 }
 
-func Diff(f1Path, f2Path, relPath string) (string, string) {
-	// 1. Check Unsaved Diff (Saved/Disk Normalized vs Editor Normalized)
-	cmd := exec.Command("git", "diff", "--no-index", "--", f1Path, f2Path)
-	output, err := cmd.CombinedOutput()
-
-	if err != nil && cmd.ProcessState.ExitCode() == 1 {
-		diffStr := string(output)
-		// Fix labels
-		// git diff --no-index usually shows path
-		diffStr = strings.ReplaceAll(diffStr, f1Path, "Saved (Normalized)")
-		diffStr = strings.ReplaceAll(diffStr, f2Path, "Editor")
-		return diffStr, "unsaved"
+// Diff compares the normalized editor content to the saved file ("unsaved")
+// and, when those match, to HEAD ("git"); "none" means no difference.
+func Diff(saved, edited []byte, relPath string) (string, string) {
+	if diff := textDiff("Saved (Normalized)", "Editor", saved, edited); diff != "" {
+		return diff, "unsaved"
 	}
 
-	// 2. Check Git Diff (HEAD Normalized vs Editor Normalized)
-	// We use f2Path (Editor Normalized) as the "New" content because f1==f2 here.
-
-	// Get HEAD content
-	// Use filepath.ToSlash to ensure forward slashes for git
-	gitPath := filepath.ToSlash(relPath)
-	cmdHead := exec.Command("git", "show", "HEAD:"+gitPath)
-	cmdHead.Dir = config.RepoPath
-	outHead, _ := cmdHead.Output()
-	// err is expected for new files, we treat it as empty
-
-	// Normalize HEAD content with defaults
+	// Missing at HEAD (a new file) compares as empty
+	headContent, _ := GetGitBackend().ShowHead(filepath.ToSlash(relPath))
 	collection, _ := GetCollectionForPath(relPath)
-	normalizedHead := NormalizeContent(outHead, collection)
+	normalizedHead := NormalizeContent(headContent, collection)
+	if diff := textDiff("HEAD (Normalized)", "Current (Normalized)", normalizedHead, edited); diff != "" {
+		return diff, "git"
+	}
+	return "", "none"
+}
 
-	// Write to temp file
-	fHead, err := os.CreateTemp("", "diff_head_*")
-	if err != nil {
-		fmt.Printf("[Diff] Warning: failed to create temp file: %v\n", err)
-		return "", "none"
+// textDiff returns a unified diff in git's format, or "" when the contents
+// are equal. It needs no git binary.
+func textDiff(fromName, toName string, from, to []byte) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+	var chunks []fdiff.Chunk
+	for _, d := range godiff.Do(string(from), string(to)) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		chunks = append(chunks, textChunk{d.Text, op})
 	}
-	defer os.Remove(fHead.Name())
-	if _, err := fHead.Write(normalizedHead); err != nil {
-		fmt.Printf("[Diff] Warning: failed to write temp file: %v\n", err)
-		return "", "none"
+	patch := textPatch{
+		from:   textFile{fromName, plumbing.ComputeHash(plumbing.BlobObject, from)},
+		to:     textFile{toName, plumbing.ComputeHash(plumbing.BlobObject, to)},
+		chunks: chunks,
 	}
-	fHead.Close()
-
-	cmdGit := exec.Command("git", "diff", "--no-index", "--", fHead.Name(), f2Path)
-	outGit, err := cmdGit.CombinedOutput()
 
-	if err != nil && cmdGit.ProcessState.ExitCode() == 1 {
-		diffStr := string(outGit)
-		diffStr = strings.ReplaceAll(diffStr, fHead.Name(), "HEAD (Normalized)")
-		diffStr = strings.ReplaceAll(diffStr, f2Path, "Current (Normalized)")
-		return diffStr, "git"
+	var buf bytes.Buffer
+	if err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).Encode(patch); err != nil {
+		fmt.Printf("[Diff] Warning: failed to encode diff: %v\n", err)
+		return ""
+	}
+	// The differing labels would otherwise read as a rename
+	header, hunks, _ := strings.Cut(buf.String(), "\n--- ")
+	var lines []string
+	for _, line := range strings.Split(header, "\n") {
+		if !strings.HasPrefix(line, "rename from ") && !strings.HasPrefix(line, "rename to ") {
+			lines = append(lines, line)
+		}
 	}
+	return strings.Join(lines, "\n") + "\n--- " + hunks
+}
 
-	return "", "none"
-}
\ No newline at end of file
+// textPatch is a single-file patch between two texts, for fdiff.UnifiedEncoder.
+type textPatch struct {
+	from, to textFile
+	chunks   []fdiff.Chunk
+}
+
+func (p textPatch) FilePatches() []fdiff.FilePatch  { return []fdiff.FilePatch{p} }
+func (p textPatch) Message() string                 { return "" }
+func (p textPatch) IsBinary() bool                  { return false }
+func (p textPatch) Files() (fdiff.File, fdiff.File) { return p.from, p.to }
+func (p textPatch) Chunks() []fdiff.Chunk           { return p.chunks }
+
+type textFile struct {
+	path string
+	hash plumbing.Hash
+}
+
+func (f textFile) Hash() plumbing.Hash     { return f.hash }
+func (f textFile) Mode() filemode.FileMode { return filemode.Regular }
+func (f textFile) Path() string            { return f.path }
+
+type textChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c textChunk) Content() string       { return c.content }
+func (c textChunk) Type() fdiff.Operation { return c.op }
+
+// runGit executes git inside config.RepoPath with optional extra environment and stdin.
+// ErrGitUnavailable is returned by the features built on git plumbing when
+// GIT_BACKEND=gogit runs without a git binary.
+var ErrGitUnavailable = errors.New("this feature needs the git binary, which is not installed (GIT_BACKEND=gogit only covers editing, syncing and publishing)")
+
+// GitBinaryAvailable reports whether git is on PATH.
+func GitBinaryAvailable() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+func runGit(env []string, stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = config.RepoPath
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), ErrGitUnavailable)
+	}
+	if err != nil {
+		return string(out), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GitHubClient is a minimal client for the GitHub REST API.
+// BaseURL defaults to config.GitHubAPIURL so tests can point it at a stub server.
+type GitHubClient struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+type PullRequest struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Head    struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewGitHubClient(token string) *GitHubClient {
+	return &GitHubClient{
+		BaseURL: config.GitHubAPIURL,
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *GitHubClient) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, g.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := g.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	fmt.Printf("[GitHub] %s %s -> %d, Duration: %v\n", method, path, resp.StatusCode, time.Since(start))
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("github %s %s: %d %s", method, path, resp.StatusCode, apiErr.Message)
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func (g *GitHubClient) ListOpenPullRequests(owner, repo, base string) ([]PullRequest, error) {
+	var prs []PullRequest
+	path := fmt.Sprintf("/repos/%s/%s/pulls?state=open&per_page=100&base=%s", owner, repo, url.QueryEscape(base))
+	if err := g.do(http.MethodGet, path, nil, &prs); err != nil {
+		return nil, err
+	}
+	return prs, nil
+}
+
+func (g *GitHubClient) CreatePullRequest(owner, repo, head, base, title, body string) (*PullRequest, error) {
+	var pr PullRequest
+	payload := map[string]string{"head": head, "base": base, "title": title, "body": body}
+	if err := g.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls", owner, repo), payload, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (g *GitHubClient) MergePullRequest(owner, repo string, number int, title string) error {
+	payload := map[string]string{"merge_method": "merge", "commit_title": title}
+	return g.do(http.MethodPut, fmt.Sprintf("/repos/%s/%s/pulls/%d/merge", owner, repo, number), payload, nil)
+}
+
+// SetLabels replaces all labels on an issue or pull request.
+func (g *GitHubClient) SetLabels(owner, repo string, number int, labels []string) error {
+	payload := map[string][]string{"labels": labels}
+	return g.do(http.MethodPut, fmt.Sprintf("/repos/%s/%s/issues/%d/labels", owner, repo, number), payload, nil)
+}
+
+func (g *GitHubClient) DeleteBranch(owner, repo, branch string) error {
+	return g.do(http.MethodDelete, fmt.Sprintf("/repos/%s/%s/git/refs/heads/%s", owner, repo, branch), nil, nil)
+}
+
+// GetAuthenticatedUser returns the profile of the token owner with their
+// primary verified email (falling back to the GitHub noreply address).
+func (g *GitHubClient) GetAuthenticatedUser() (*models.GitUser, error) {
+	var profile struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := g.do(http.MethodGet, "/user", nil, &profile); err != nil {
+		return nil, err
+	}
+
+	user := &models.GitUser{Login: profile.Login, Name: profile.Name, Email: profile.Email}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := g.do(http.MethodGet, "/user/emails", nil, &emails); err == nil {
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				user.Email = e.Email
+				break
+			}
+		}
+	}
+	if user.Email == "" {
+		user.Email = fmt.Sprintf("%d+%s@users.noreply.github.com", profile.ID, profile.Login)
+	}
+	return user, nil
+}
+
+// GetRemoteRepo resolves the GitHub owner and repository name of the configured remote.
+func GetRemoteRepo() (string, string, error) {
+	remoteURL, err := getRemoteURL(config.GitRemote)
+	if err != nil {
+		return "", "", err
+	}
+	return parseGitHubRepo(remoteURL)
+}
+
+func parseGitHubRepo(remoteURL string) (string, string, error) {
+	repoPath := remoteURL
+	if u := parseRemoteURL(remoteURL); u != nil {
+		repoPath = u.Path
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	parts := strings.Split(repoPath, "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", fmt.Errorf("cannot determine GitHub repository from %q", remoteURL)
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
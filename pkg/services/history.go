@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var shaPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// ArticleHistory returns the commits touching a content file, newest first, following renames.
+func ArticleHistory(relPath string) ([]models.Revision, error) {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[History] Log %s, Duration: %v\n", relPath, time.Since(start))
+	}()
+
+	gitPath := filepath.ToSlash(filepath.Join("content", relPath))
+	// Each record starts with \x1e; fields are separated by \x1f and the
+	// file name (as of that commit) follows from --name-only.
+	out, err := runGit(nil, nil, "log", "--follow", "--name-only",
+		"--format=%x1e%H%x1f%an%x1f%ae%x1f%aI%x1f%s", "--", gitPath)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []models.Revision{}
+	for _, record := range strings.Split(out, "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		lines := strings.SplitN(record, "\n", 2)
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+
+		rev := models.Revision{
+			SHA:     fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Message: fields[4],
+			Path:    gitPath,
+		}
+		rev.Date, _ = time.Parse(time.RFC3339, fields[3])
+		if len(lines) == 2 {
+			if name := strings.TrimSpace(lines[1]); name != "" {
+				rev.Path = strings.SplitN(name, "\n", 2)[0]
+			}
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// revisionContent reads a content file as it was at the given commit.
+func revisionContent(relPath, sha string) ([]byte, error) {
+	if !shaPattern.MatchString(sha) {
+		return nil, fmt.Errorf("invalid revision: %s", sha)
+	}
+
+	gitPath := filepath.ToSlash(filepath.Join("content", relPath))
+	if out, err := runGit(nil, nil, "show", sha+":"+gitPath); err == nil {
+		return []byte(out), nil
+	}
+
+	// The file may have been renamed since; look up its name at that commit.
+	history, err := ArticleHistory(relPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range history {
+		if strings.HasPrefix(rev.SHA, strings.ToLower(sha)) {
+			out, err := runGit(nil, nil, "show", rev.SHA+":"+rev.Path)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(out), nil
+		}
+	}
+	return nil, fmt.Errorf("revision %s not found in history of %s", sha, relPath)
+}
+
+// ArticleRevision returns an article parsed as it was at the given commit.
+func ArticleRevision(relPath, sha string) (*models.Article, error) {
+	content, err := revisionContent(relPath, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	fm, body, format, err := ParseFrontMatter(content)
+	if err != nil {
+		return &models.Article{Path: relPath, Content: string(content)}, nil
+	}
+	return &models.Article{
+		Path:        relPath,
+		FrontMatter: fm,
+		Body:        body,
+		Format:      format,
+	}, nil
+}
+
+// RestoreRevision writes an old revision of an article back to the working tree.
+func RestoreRevision(relPath, sha string) error {
+	fullPath := SafeJoin(config.RepoPath, "content", relPath)
+	if fullPath == "" {
+		return fmt.Errorf("invalid path")
+	}
+
+	content, err := revisionContent(relPath, sha)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, content, 0644)
+}
@@ -1,8 +1,12 @@
 package services
 
 import (
+	"bytes"
 	"fmt"
 	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,65 +14,91 @@ import (
 	"time"
 )
 
-var hugoServerCmd *exec.Cmd
+// hugoServer supervises the `hugo server` behind the /preview/ proxy.
+var hugoServer *ProcessSupervisor
 
+// StartHugoServer starts the supervised preview server. Crashes and failed
+// health checks restart it with backoff until StopHugoServer is called.
 func StartHugoServer() error {
-	if hugoServerCmd != nil && hugoServerCmd.Process != nil {
-		// Check if process is still alive?
-		// For simplicity assume if variable is set, it's running.
-		// The goroutine below clears it on exit.
+	if _, err := exec.LookPath("hugo"); err != nil {
+		return fmt.Errorf("failed to start hugo server: %w", err)
+	}
+	if hugoServer != nil {
 		return nil
 	}
 
 	fmt.Printf("[Hugo] Starting server on :%s...\n", config.HugoServerPort)
+	hugoServer = NewProcessSupervisor("Hugo", net.JoinHostPort(config.HugoServerBind, config.HugoServerPort), config.HugoLogLines, func() *exec.Cmd {
+		return exec.Command("hugo", "server",
+			"--source", config.RepoPath,
+			"--bind", config.HugoServerBind,
+			"--port", config.HugoServerPort,
+			"--baseURL", config.GetAppURL()+config.PreviewURL,
+			"--appendPort=false",
+			"--disableLiveReload", // Disable WS to avoid timeouts on mobile/proxy
+			"-D",                  // Include drafts
+			"-F",                  // Include future
+		)
+	})
+	hugoServer.OnLine = hugoLineHandler(HugoSourceServer)
+	hugoServer.Start()
+	return nil
+}
 
-	cmd := exec.Command("hugo", "server",
-		"--source", config.RepoPath,
-		"--bind", config.HugoServerBind,
-		"--port", config.HugoServerPort,
-		"--baseURL", config.GetAppURL()+config.PreviewURL,
-		"--appendPort=false",
-		"--disableLiveReload", // Disable WS to avoid timeouts on mobile/proxy
-		"-D",                  // Include drafts
-		"-F",                  // Include future
-	)
-
-	// Pipe output to stdout for debugging
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start hugo server: %w", err)
+// StopHugoServer terminates the preview server, e.g. on shutdown.
+func StopHugoServer() {
+	if hugoServer != nil {
+		hugoServer.Stop()
 	}
+}
 
-	hugoServerCmd = cmd
-
-	// Wait in goroutine
-	go func() {
-		state, err := cmd.Process.Wait()
-		fmt.Printf("[Hugo] Server stopped. State: %v, Err: %v\n", state, err)
-		hugoServerCmd = nil
-	}()
-
+// RestartHugoServer restarts the preview server.
+func RestartHugoServer() error {
+	if hugoServer == nil {
+		return StartHugoServer()
+	}
+	hugoServer.Restart()
 	return nil
 }
 
-func BuildSite() (string, error) {
+// HugoServerStatus reports the preview server state and its recent output.
+func HugoServerStatus() models.ProcessStatus {
+	if hugoServer == nil {
+		return models.ProcessStatus{Name: "Hugo", State: ProcessStopped, Logs: []string{}}
+	}
+	return hugoServer.Status()
+}
+
+// BuildSite renders a production build (the site's own baseURL, without
+// drafts and future posts) of the site in source into destination. Output is
+// streamed to the hugo event subscribers as it is produced and returned as a
+// whole at the end.
+func BuildSite(source, destination string) (string, error) {
 	start := time.Now()
 	defer func() {
 		fmt.Printf("[Hugo] Build Duration: %v\n", time.Since(start))
 	}()
 
+	// hugo resolves a relative destination against --source
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return "Invalid build destination", err
+	}
 	cmd := exec.Command("hugo",
-		"--source", config.RepoPath,
-		"--destination", "public",
-		"--baseURL", config.GetAppURL()+config.PreviewURL,
+		"--source", source,
+		"--destination", destination,
 		"--cleanDestinationDir",
-		"-D",
-		"-F",
 	)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	var output bytes.Buffer
+	lines := &lineWriter{onLine: hugoLineHandler(HugoSourceBuild)}
+	out := io.MultiWriter(&output, lines)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	publishHugoEvent(models.HugoEvent{Type: HugoEventBuildStart, Source: HugoSourceBuild, Message: "Building site", Time: time.Now()})
+	err = cmd.Run()
+	lines.Flush()
+	return output.String(), err
 }
 
 func CreateContent(path string) (string, error) {
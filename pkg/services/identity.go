@@ -0,0 +1,45 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"strings"
+)
+
+// commitIdentityEnv returns the environment that attributes a commit to the
+// editor. Identity is passed per command rather than via `git config`,
+// because concurrent users share the same repository.
+// A nil author falls back to the bot for both author and committer.
+func commitIdentityEnv(author *models.GitUser) []string {
+	a, c := commitIdentity(author)
+	return []string{
+		"GIT_AUTHOR_NAME=" + a.Name,
+		"GIT_AUTHOR_EMAIL=" + a.Email,
+		"GIT_COMMITTER_NAME=" + c.Name,
+		"GIT_COMMITTER_EMAIL=" + c.Email,
+	}
+}
+
+// commitIdentity resolves the author and committer of a commit made for author.
+func commitIdentity(author *models.GitUser) (models.GitUser, models.GitUser) {
+	bot := models.GitUser{Name: config.GitUserName, Email: config.GitUserEmail}
+	if author == nil || author.Email == "" {
+		return bot, bot
+	}
+
+	editor := models.GitUser{Login: author.Login, Name: author.DisplayName(), Email: author.Email}
+	if config.GitBotRole == "coauthor" {
+		return editor, editor
+	}
+	return editor, bot
+}
+
+// commitMessageFor appends a Co-authored-by trailer for the bot when it is
+// configured as co-author rather than committer.
+func commitMessageFor(msg string, author *models.GitUser) string {
+	if author == nil || author.Email == "" || config.GitBotRole != "coauthor" {
+		return msg
+	}
+	return fmt.Sprintf("%s\n\nCo-authored-by: %s <%s>", strings.TrimRight(msg, "\n"), config.GitUserName, config.GitUserEmail)
+}
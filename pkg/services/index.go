@@ -0,0 +1,350 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bump when indexEntry changes meaning; older indexes are then rebuilt.
+const indexVersion = "3"
+
+var (
+	indexArticlesBucket = []byte("articles")
+	indexMetaBucket     = []byte("meta")
+)
+
+// indexEntry is what the article index remembers about a content file,
+// keyed by its slash-separated content-relative path. An entry is reused
+// while the file's mtime and size, or failing that its hash, are unchanged;
+// the dirty state also needs HEAD to be the commit it was computed against.
+type indexEntry struct {
+	ModTime int64  `json:"mtime"` // UnixNano
+	Size    int64  `json:"size"`
+	Hash    string `json:"hash"` // SHA-256 of the content
+	Dirty   bool   `json:"dirty"`
+	Head    string `json:"head,omitempty"` // Commit Dirty was computed against, for changed files
+
+	Title      string                 `json:"title"`
+	Params     map[string]interface{} `json:"params,omitempty"` // See summarizeFrontMatter
+	Tags       []string               `json:"tags,omitempty"`
+	Categories []string               `json:"categories,omitempty"`
+}
+
+// Longest string front matter value kept, in characters; enough to sort by
+const maxParamLength = 200
+
+// Front matter holding dates, kept as RFC 3339 in UTC so they sort as strings
+var dateParams = []string{"date", "lastmod", "publishdate", "expirydate"}
+
+var (
+	indexMu   sync.Mutex
+	indexDB   *bolt.DB
+	indexOpen bool
+)
+
+func indexPath() string {
+	return filepath.Join(config.CMSDataDir, "index.db")
+}
+
+// articleIndex returns the on-disk index, opening it on first use, or nil
+// if it is unavailable; the cache then falls back to reading every file.
+func articleIndex() *bolt.DB {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if indexOpen {
+		return indexDB
+	}
+	indexOpen = true
+
+	if err := os.MkdirAll(config.CMSDataDir, 0755); err != nil {
+		fmt.Printf("[Index] Disabled: %v\n", err)
+		return nil
+	}
+	// Another process holding the file would block forever without a timeout
+	db, err := bolt.Open(indexPath(), 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		fmt.Printf("[Index] Disabled: %v\n", err)
+		return nil
+	}
+
+	// Entries of another repository or an older format are of no use
+	repo, _ := filepath.Abs(config.RepoPath)
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(indexMetaBucket)
+		if err != nil {
+			return err
+		}
+		if string(meta.Get([]byte("version"))) != indexVersion || string(meta.Get([]byte("repo"))) != repo {
+			if tx.Bucket(indexArticlesBucket) != nil {
+				if err := tx.DeleteBucket(indexArticlesBucket); err != nil {
+					return err
+				}
+			}
+			if err := meta.Put([]byte("version"), []byte(indexVersion)); err != nil {
+				return err
+			}
+			if err := meta.Put([]byte("repo"), []byte(repo)); err != nil {
+				return err
+			}
+		}
+		_, err = tx.CreateBucketIfNotExists(indexArticlesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		fmt.Printf("[Index] Disabled: %v\n", err)
+		return nil
+	}
+	indexDB = db
+	return indexDB
+}
+
+// CloseIndex closes the on-disk index, e.g. on shutdown.
+func CloseIndex() {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if indexDB != nil {
+		indexDB.Close()
+		indexDB = nil
+	}
+	indexOpen = false
+}
+
+func loadIndexEntries() map[string]indexEntry {
+	entries := map[string]indexEntry{}
+	db := articleIndex()
+	if db == nil {
+		return entries
+	}
+	db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexArticlesBucket).ForEach(func(k, v []byte) error {
+			var entry indexEntry
+			if json.Unmarshal(v, &entry) == nil {
+				entries[string(k)] = entry
+			}
+			return nil
+		})
+	})
+	return entries
+}
+
+func getIndexEntry(key string) (indexEntry, bool) {
+	db := articleIndex()
+	if db == nil {
+		return indexEntry{}, false
+	}
+	var entry indexEntry
+	found := false
+	db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(indexArticlesBucket).Get([]byte(key)); v != nil {
+			found = json.Unmarshal(v, &entry) == nil
+		}
+		return nil
+	})
+	return entry, found
+}
+
+// replaceIndexEntries stores entries as the complete index.
+func replaceIndexEntries(entries map[string]indexEntry) {
+	db := articleIndex()
+	if db == nil {
+		return
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(indexArticlesBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(indexArticlesBucket)
+		if err != nil {
+			return err
+		}
+		for key, entry := range entries {
+			if err := putIndexEntryTx(bucket, key, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[Index] Failed to save: %v\n", err)
+	}
+}
+
+func putIndexEntry(key string, entry indexEntry) {
+	db := articleIndex()
+	if db == nil {
+		return
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		return putIndexEntryTx(tx.Bucket(indexArticlesBucket), key, entry)
+	})
+	if err != nil {
+		fmt.Printf("[Index] Failed to save %s: %v\n", key, err)
+	}
+}
+
+func putIndexEntryTx(bucket *bolt.Bucket, key string, entry indexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
+
+// deleteIndexEntries removes the entry of key and, for a directory, the
+// entries below it.
+func deleteIndexEntries(key string) {
+	db := articleIndex()
+	if db == nil {
+		return
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(indexArticlesBucket)
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+		prefix := []byte(key + "/")
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Seek(prefix) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[Index] Failed to remove %s: %v\n", key, err)
+	}
+}
+
+// refreshIndexEntry brings the entry of a content file up to date and
+// reports whether it changed: the file is only read when mtime or size
+// changed, only parsed when its hash did, and its semantic diff only
+// recomputed when it is changed in git (changed) and the content or HEAD
+// moved since the last check.
+func refreshIndexEntry(fullPath, repoRel string, info fs.FileInfo, entry indexEntry, found bool, head string, changed bool) (indexEntry, bool, error) {
+	updated := false
+	if !found || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() {
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return indexEntry{}, false, err
+		}
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if !found || hash != entry.Hash {
+			contentRel := strings.TrimPrefix(repoRel, "content/")
+			entry = summarizeArticle(content, filepath.FromSlash(contentRel))
+			entry.Hash = hash
+		}
+		entry.ModTime = info.ModTime().UnixNano()
+		entry.Size = info.Size()
+		updated = true
+	}
+
+	switch {
+	case !changed:
+		// Matches HEAD whatever HEAD is, so nothing to remember
+		updated = updated || entry.Dirty || entry.Head != ""
+		entry.Dirty = false
+		entry.Head = ""
+	case head == "" || entry.Head != head:
+		diff, err := CheckSemanticDiff(repoRel)
+		entry.Dirty = err != nil || diff
+		entry.Head = head
+		updated = true
+	}
+	return entry, updated, nil
+}
+
+// summarizeArticle returns an entry holding the front matter the cache
+// keeps; the title falls back to the content-relative path.
+func summarizeArticle(content []byte, relPath string) indexEntry {
+	entry := indexEntry{Title: relPath}
+	fm, _, _, err := ParseFrontMatter(content)
+	if err != nil {
+		return entry
+	}
+	if t, ok := fm["title"].(string); ok {
+		entry.Title = t
+	}
+	entry.Params = summarizeFrontMatter(fm)
+	entry.Tags = frontMatterStrings(fm, "tags")
+	entry.Categories = frontMatterStrings(fm, "categories")
+	return entry
+}
+
+// summarizeFrontMatter returns the scalar top-level fields of fm with
+// lowercased keys (Hugo ignores their case), so the list can be sorted by
+// any of them: numbers as float64, dates as RFC 3339 strings in UTC.
+func summarizeFrontMatter(fm map[string]interface{}) map[string]interface{} {
+	params := map[string]interface{}{}
+	for key, value := range fm {
+		key = strings.ToLower(key)
+		switch v := value.(type) {
+		case string:
+			if utf8.RuneCountInString(v) > maxParamLength {
+				v = string([]rune(v)[:maxParamLength])
+			}
+			params[key] = v
+		case bool:
+			params[key] = v
+		case int:
+			params[key] = float64(v)
+		case int64:
+			params[key] = float64(v)
+		case uint64:
+			params[key] = float64(v)
+		case float64:
+			params[key] = v
+		}
+	}
+	for _, key := range dateParams {
+		if t := frontMatterTime(fm, key); !t.IsZero() {
+			params[key] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return params
+}
+
+// article returns the cached form of the article at the content-relative
+// relPath.
+func (e indexEntry) article(relPath string) models.Article {
+	art := models.Article{
+		Path:       relPath,
+		Title:      e.Title,
+		IsDirty:    e.Dirty,
+		Tags:       e.Tags,
+		Categories: e.Categories,
+		Params:     e.Params,
+	}
+	art.Date, _ = e.Params["date"].(string)
+	art.Lastmod, _ = e.Params["lastmod"].(string)
+	// Org Mode front matter only has strings, which Hugo casts
+	switch draft := e.Params["draft"].(type) {
+	case bool:
+		art.Draft = draft
+	case string:
+		art.Draft, _ = strconv.ParseBool(draft)
+	}
+	switch weight := e.Params["weight"].(type) {
+	case float64:
+		art.Weight = int(weight)
+	case string:
+		art.Weight, _ = strconv.Atoi(weight)
+	}
+	return art
+}
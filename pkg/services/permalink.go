@@ -0,0 +1,447 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNotRendered = errors.New("page is not rendered")
+
+// siteConfig is the part of the Hugo site config that decides URLs. Hugo
+// config keys are case-insensitive, so all map keys are lowercased.
+type siteConfig struct {
+	permalinks         map[string]interface{}
+	uglyURLs           bool
+	disablePathToLower bool
+	defaultLanguage    string
+	defaultInSubdir    bool
+	languages          map[string]siteLanguage
+}
+
+type siteLanguage struct {
+	contentDir string // Repo-relative, if the language has its own
+}
+
+var permalinkToken = regexp.MustCompile(`:[a-z]+`)
+
+// loadSiteConfig reads the site config file (hugo.* or config.*, in TOML,
+// YAML or JSON) and config/_default, where permalinks and languages may
+// live in files of their own.
+func loadSiteConfig() (*siteConfig, error) {
+	values := map[string]interface{}{}
+	merge := func(file, key string) (bool, error) {
+		parsed, err := decodeConfigFile(file)
+		if err != nil || parsed == nil {
+			return false, err
+		}
+		if key != "" {
+			values[key] = parsed
+			return true, nil
+		}
+		for k, v := range parsed {
+			values[k] = v
+		}
+		return true, nil
+	}
+
+	exts := []string{"toml", "yaml", "yml", "json"}
+	found := false
+	for _, base := range []string{"hugo", "config"} {
+		for _, ext := range exts {
+			ok, err := merge(filepath.Join(config.RepoPath, base+"."+ext), "")
+			if err != nil {
+				return nil, err
+			}
+			if found = ok; found {
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	defaultDir := filepath.Join(config.RepoPath, "config", "_default")
+	for _, base := range []string{"hugo", "config", "permalinks", "languages"} {
+		key := base
+		if base == "hugo" || base == "config" {
+			key = ""
+		}
+		for _, ext := range exts {
+			if _, err := merge(filepath.Join(defaultDir, base+"."+ext), key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cfg := &siteConfig{
+		defaultLanguage: "en",
+		languages:       map[string]siteLanguage{},
+	}
+	cfg.permalinks, _ = values["permalinks"].(map[string]interface{})
+	cfg.uglyURLs, _ = values["uglyurls"].(bool)
+	cfg.disablePathToLower, _ = values["disablepathtolower"].(bool)
+	cfg.defaultInSubdir, _ = values["defaultcontentlanguageinsubdir"].(bool)
+	if lang, ok := values["defaultcontentlanguage"].(string); ok && lang != "" {
+		cfg.defaultLanguage = strings.ToLower(lang)
+	}
+	if languages, ok := values["languages"].(map[string]interface{}); ok {
+		for code, v := range languages {
+			var lang siteLanguage
+			if settings, ok := v.(map[string]interface{}); ok {
+				lang.contentDir, _ = settings["contentdir"].(string)
+			}
+			cfg.languages[code] = lang
+		}
+	}
+	return cfg, nil
+}
+
+// decodeConfigFile parses a config file by extension; a missing file
+// returns nil without error.
+func decodeConfigFile(file string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	switch filepath.Ext(file) {
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	case ".json":
+		err = json.Unmarshal(content, &values)
+	default:
+		err = yaml.Unmarshal(content, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(file), err)
+	}
+	return lowerKeys(values), nil
+}
+
+func lowerKeys(values map[string]interface{}) map[string]interface{} {
+	lowered := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if inner, ok := v.(map[string]interface{}); ok {
+			v = lowerKeys(inner)
+		}
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
+
+// multilingual reports whether language prefixes are in use at all.
+func (c *siteConfig) multilingual() bool {
+	return len(c.languages) > 1 || c.defaultInSubdir
+}
+
+// permalinkPattern returns the configured pattern for a section and page
+// kind. Both the flat form (posts = "...") and the per-kind form
+// ([permalinks.page] posts = "...") are supported; the flat form applies
+// to regular pages only.
+func (c *siteConfig) permalinkPattern(section, kind string) string {
+	if byKind, ok := c.permalinks[kind].(map[string]interface{}); ok {
+		pattern, _ := byKind[section].(string)
+		return pattern
+	}
+	if kind != "page" {
+		return ""
+	}
+	pattern, _ := c.permalinks[section].(string)
+	return pattern
+}
+
+// makePath turns s into a URL path the way Hugo does: spaces become
+// hyphens, characters other than letters, digits and a few separators are
+// dropped, and the result is lowercased unless disablePathToLower is set.
+func (c *siteConfig) makePath(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			b.WriteRune(r)
+		case strings.ContainsRune("./\\_-#+~", r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+		}
+	}
+	if c.disablePathToLower {
+		return b.String()
+	}
+	return strings.ToLower(b.String())
+}
+
+// ResolvePreviewURL resolves a content-relative path to the permalink Hugo
+// renders it at, following the site's permalinks, uglyURLs and language
+// settings and the article's url, slug and aliases front matter.
+func ResolvePreviewURL(contentPath string) (models.PreviewURL, error) {
+	fullPath := SafeJoin(config.RepoPath, "content", contentPath)
+	if fullPath == "" {
+		return models.PreviewURL{}, fmt.Errorf("invalid path: %s", contentPath)
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return models.PreviewURL{}, err
+	}
+	return resolvePreviewURL(contentPath, content)
+}
+
+// resolvePreviewURL resolves the URL of contentPath as if it held content.
+func resolvePreviewURL(contentPath string, content []byte) (models.PreviewURL, error) {
+	fm, _, _, _ := ParseFrontMatter(content)
+	if fm == nil {
+		fm = map[string]interface{}{}
+	}
+
+	if headless, _ := fm["headless"].(bool); headless {
+		return models.PreviewURL{}, ErrNotRendered
+	}
+	if build, ok := fm["build"].(map[string]interface{}); ok {
+		if render := fmt.Sprint(build["render"]); render == "never" || render == "false" {
+			return models.PreviewURL{}, ErrNotRendered
+		}
+	}
+
+	cfg, err := loadSiteConfig()
+	if err != nil {
+		return models.PreviewURL{}, err
+	}
+	return cfg.resolve(filepath.ToSlash(filepath.Clean(contentPath)), fm), nil
+}
+
+func (c *siteConfig) resolve(rel string, fm map[string]interface{}) models.PreviewURL {
+	// Language: a language's own content directory, then a filename suffix
+	// (post.ja.md), then the default language
+	lang := ""
+	for code, l := range c.languages {
+		dir := strings.TrimPrefix(path.Clean(filepath.ToSlash(l.contentDir)), "content/")
+		if l.contentDir != "" && strings.HasPrefix(rel, dir+"/") {
+			lang, rel = code, strings.TrimPrefix(rel, dir+"/")
+			break
+		}
+	}
+	dir, stem := path.Dir(rel), strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	if dir == "." {
+		dir = ""
+	}
+	if i := strings.LastIndex(stem, "."); i > 0 {
+		if _, ok := c.languages[strings.ToLower(stem[i+1:])]; ok {
+			if lang == "" {
+				lang = strings.ToLower(stem[i+1:])
+			}
+			stem = stem[:i]
+		}
+	}
+	if lang == "" {
+		lang = c.defaultLanguage
+	}
+
+	// Kind and base name: a leaf bundle (index.md) is named after its directory
+	kind, name := "page", stem
+	switch {
+	case stem == "_index" && dir == "":
+		kind, name = "home", ""
+	case stem == "_index":
+		kind, name = "section", path.Base(dir)
+		dir = path.Dir(dir)
+	case stem == "index" && dir != "":
+		name = path.Base(dir)
+		dir = path.Dir(dir)
+	}
+	if dir == "." {
+		dir = ""
+	}
+	section := strings.SplitN(path.Join(dir, name), "/", 2)[0]
+	if kind == "page" {
+		section = strings.SplitN(dir, "/", 2)[0]
+	}
+
+	langPrefix := ""
+	if c.multilingual() && (lang != c.defaultLanguage || c.defaultInSubdir) {
+		langPrefix = "/" + lang
+	}
+	withPrefix := func(p string) string {
+		// Like Hugo, only relative values get the language prefix
+		if strings.HasPrefix(p, "/") {
+			return p
+		}
+		return langPrefix + "/" + p
+	}
+
+	var permalink string
+	if u := frontMatterString(fm, "url"); u != "" {
+		permalink = withPrefix(u)
+	} else {
+		var p string
+		pattern := c.permalinkPattern(section, kind)
+		switch {
+		case kind == "home":
+			p = "/"
+		case pattern != "":
+			p = c.expandPermalink(pattern, section, dir, name, fm)
+		case kind == "section":
+			p = "/" + c.makePath(path.Join(dir, name)) + "/"
+		default:
+			slug := name
+			if s := frontMatterString(fm, "slug"); s != "" {
+				slug = s
+			}
+			p = "/" + c.makePath(path.Join(dir, slug)) + "/"
+		}
+		if c.uglyURLs && kind == "page" {
+			p = strings.TrimSuffix(p, "/") + ".html"
+		}
+		permalink = langPrefix + p
+	}
+
+	// Relative aliases are relative to the page's own URL
+	base := permalink
+	if !strings.HasSuffix(base, "/") {
+		base = path.Dir(base) + "/"
+	}
+	var aliases []string
+	for _, alias := range frontMatterStrings(fm, "aliases") {
+		if !strings.HasPrefix(alias, "/") {
+			alias = path.Join(base, alias)
+		}
+		aliases = append(aliases, alias)
+	}
+
+	result := models.PreviewURL{
+		Path:    permalink,
+		URL:     strings.TrimSuffix(config.PreviewURL, "/") + permalink,
+		Kind:    kind,
+		Aliases: aliases,
+	}
+	if c.multilingual() {
+		result.Language = lang
+	}
+	return result
+}
+
+// expandPermalink fills in a permalinks pattern such as /:year/:month/:slug/.
+func (c *siteConfig) expandPermalink(pattern, section, dir, name string, fm map[string]interface{}) string {
+	date := frontMatterTime(fm, "date", "publishdate", "lastmod")
+	title := frontMatterString(fm, "title")
+	slug := frontMatterString(fm, "slug")
+
+	expanded := permalinkToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		switch token {
+		case ":year":
+			return date.Format("2006")
+		case ":month":
+			return date.Format("01")
+		case ":monthname":
+			return c.makePath(date.Format("January"))
+		case ":day":
+			return date.Format("02")
+		case ":weekday":
+			return fmt.Sprint(int(date.Weekday()))
+		case ":weekdayname":
+			return c.makePath(date.Format("Monday"))
+		case ":yearday":
+			return fmt.Sprint(date.YearDay())
+		case ":section":
+			return c.makePath(section)
+		case ":sections":
+			return c.makePath(dir)
+		case ":title":
+			return c.makePath(title)
+		case ":slug":
+			if slug != "" {
+				return c.makePath(slug)
+			}
+			return c.makePath(title)
+		case ":slugorfilename", ":slugorcontentbasename":
+			if slug != "" {
+				return c.makePath(slug)
+			}
+			return c.makePath(name)
+		case ":filename", ":contentbasename":
+			return c.makePath(name)
+		}
+		return token
+	})
+
+	expanded = "/" + strings.Trim(expanded, "/") + "/"
+	for strings.Contains(expanded, "//") {
+		expanded = strings.ReplaceAll(expanded, "//", "/")
+	}
+	return expanded
+}
+
+// frontMatterString looks up a string value, ignoring the key's case.
+func frontMatterString(fm map[string]interface{}, key string) string {
+	for k, v := range fm {
+		if strings.EqualFold(k, key) {
+			if s, ok := v.(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+	}
+	return ""
+}
+
+func frontMatterStrings(fm map[string]interface{}, key string) []string {
+	for k, v := range fm {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		switch list := v.(type) {
+		case []interface{}:
+			var values []string
+			for _, item := range list {
+				if s, ok := item.(string); ok && s != "" {
+					values = append(values, s)
+				}
+			}
+			return values
+		case string:
+			return []string{list}
+		}
+	}
+	return nil
+}
+
+// frontMatterTime returns the first of keys holding a date.
+func frontMatterTime(fm map[string]interface{}, keys ...string) time.Time {
+	for _, key := range keys {
+		for k, v := range fm {
+			if !strings.EqualFold(k, key) {
+				continue
+			}
+			switch t := v.(type) {
+			case time.Time:
+				return t
+			case toml.LocalDate:
+				return t.AsTime(time.UTC)
+			case toml.LocalDateTime:
+				return t.AsTime(time.UTC)
+			case string:
+				for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+					if parsed, err := time.Parse(layout, t); err == nil {
+						return parsed
+					}
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
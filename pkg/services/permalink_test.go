@@ -0,0 +1,111 @@
+package services
+
+import (
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"reflect"
+	"testing"
+)
+
+func TestSiteConfigResolve(t *testing.T) {
+	previewURL := config.PreviewURL
+	t.Cleanup(func() { config.PreviewURL = previewURL })
+	config.PreviewURL = "/preview/"
+
+	plain := &siteConfig{defaultLanguage: "en", languages: map[string]siteLanguage{}}
+	permalinks := &siteConfig{
+		defaultLanguage: "en",
+		languages:       map[string]siteLanguage{},
+		permalinks: map[string]interface{}{
+			"posts":   "/:year/:month/:slug/",
+			"section": map[string]interface{}{"docs": "/manual/:title/"},
+		},
+	}
+	ugly := &siteConfig{defaultLanguage: "en", languages: map[string]siteLanguage{}, uglyURLs: true}
+	multilingual := &siteConfig{
+		defaultLanguage: "en",
+		languages: map[string]siteLanguage{
+			"en": {},
+			"ja": {},
+			"fr": {contentDir: "content/french"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		cfg  *siteConfig
+		rel  string
+		fm   map[string]interface{}
+		want models.PreviewURL // URL is derived from Path
+	}{
+		{"home", plain, "_index.md", nil, models.PreviewURL{Path: "/", Kind: "home"}},
+		{"section", plain, "posts/_index.md", nil, models.PreviewURL{Path: "/posts/", Kind: "section"}},
+		{"nested section", plain, "docs/guides/_index.md", nil, models.PreviewURL{Path: "/docs/guides/", Kind: "section"}},
+		{"page", plain, "posts/Hello World.md", nil, models.PreviewURL{Path: "/posts/hello-world/", Kind: "page"}},
+		{"leaf bundle", plain, "posts/trip/index.md", nil, models.PreviewURL{Path: "/posts/trip/", Kind: "page"}},
+		{"slug", plain, "posts/a.md", map[string]interface{}{"slug": "Other Name"}, models.PreviewURL{Path: "/posts/other-name/", Kind: "page"}},
+		{"absolute url", plain, "posts/a.md", map[string]interface{}{"url": "/custom/"}, models.PreviewURL{Path: "/custom/", Kind: "page"}},
+		{
+			"aliases", plain, "posts/a.md",
+			map[string]interface{}{"aliases": []interface{}{"/old/", "older"}},
+			models.PreviewURL{Path: "/posts/a/", Kind: "page", Aliases: []string{"/old/", "/posts/a/older"}},
+		},
+		{
+			"page pattern", permalinks, "posts/a.md",
+			map[string]interface{}{"date": "2024-03-09", "title": "A Title"},
+			models.PreviewURL{Path: "/2024/03/a-title/", Kind: "page"},
+		},
+		{"section pattern", permalinks, "docs/_index.md", map[string]interface{}{"title": "Docs"}, models.PreviewURL{Path: "/manual/docs/", Kind: "section"}},
+		{"flat pattern is for pages only", permalinks, "posts/_index.md", nil, models.PreviewURL{Path: "/posts/", Kind: "section"}},
+		{"ugly page", ugly, "posts/a.md", nil, models.PreviewURL{Path: "/posts/a.html", Kind: "page"}},
+		{"ugly section", ugly, "posts/_index.md", nil, models.PreviewURL{Path: "/posts/", Kind: "section"}},
+		{"default language", multilingual, "posts/a.md", nil, models.PreviewURL{Path: "/posts/a/", Kind: "page", Language: "en"}},
+		{"language suffix", multilingual, "posts/a.ja.md", nil, models.PreviewURL{Path: "/ja/posts/a/", Kind: "page", Language: "ja"}},
+		{"language content dir", multilingual, "french/posts/a.md", nil, models.PreviewURL{Path: "/fr/posts/a/", Kind: "page", Language: "fr"}},
+		{"relative url", multilingual, "posts/a.ja.md", map[string]interface{}{"url": "custom/"}, models.PreviewURL{Path: "/ja/custom/", Kind: "page", Language: "ja"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			want.URL = "/preview" + want.Path
+			if got := tt.cfg.resolve(tt.rel, tt.fm); !reflect.DeepEqual(got, want) {
+				t.Errorf("resolve(%q) = %+v, want %+v", tt.rel, got, want)
+			}
+		})
+	}
+}
+
+func TestExpandPermalink(t *testing.T) {
+	cfg := &siteConfig{}
+	fm := map[string]interface{}{"date": "2024-03-09T10:00:00Z", "title": "Hello, World!"}
+	withSlug := map[string]interface{}{"title": "Hello", "slug": "My Slug"}
+
+	tests := []struct {
+		name    string
+		cfg     *siteConfig
+		pattern string
+		fm      map[string]interface{}
+		want    string
+	}{
+		{"date", cfg, "/:year/:month/:day/:filename/", fm, "/2024/03/09/my-post/"},
+		{"names", cfg, "/:monthname/:weekdayname/", fm, "/march/saturday/"},
+		{"numbers", cfg, ":weekday/:yearday", fm, "/6/69/"},
+		{"sections", cfg, "/:section/:sections/:contentbasename/", fm, "/blog/blog/2024/my-post/"},
+		{"title", cfg, "/:title/", fm, "/hello-world/"},
+		{"slug falls back to title", cfg, "/:slug/", fm, "/hello-world/"},
+		{"slug", cfg, "/:slug/", withSlug, "/my-slug/"},
+		{"slug or filename", cfg, "/:slugorfilename/", fm, "/my-post/"},
+		{"slug or filename with slug", cfg, "/:slugorcontentbasename/", withSlug, "/my-slug/"},
+		{"unknown token", cfg, "/:unknown/:filename", fm, "/:unknown/my-post/"},
+		{"no date", cfg, "/:year/:filename/", nil, "/0001/my-post/"},
+		{"empty segments", cfg, "//:slug//", map[string]interface{}{}, "/"},
+		{"keeps case", &siteConfig{disablePathToLower: true}, "/:title/", fm, "/Hello-World/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.expandPermalink(tt.pattern, "blog", "blog/2024", "My Post", tt.fm); got != tt.want {
+				t.Errorf("expandPermalink(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"sort"
+	"strings"
+)
+
+// ErrPushConflict is returned when a rejected push could not be rebased onto
+// the remote branch without conflicts. The local commits are kept unpushed.
+var ErrPushConflict = errors.New("push rejected and local commits conflict with the remote branch")
+
+// upstreamRef is the remote-tracking ref of config.GitBranch. It is updated
+// explicitly because ExecuteGitWithToken talks to the remote by URL.
+func upstreamRef() string {
+	return "refs/remotes/" + config.GitRemote + "/" + config.GitBranch
+}
+
+func isPushRejected(log string) bool {
+	return strings.Contains(log, "[rejected]") ||
+		strings.Contains(log, "non-fast-forward") ||
+		strings.Contains(log, "fetch first")
+}
+
+// fetchUpstream updates upstreamRef from the remote.
+func fetchUpstream(token string) (string, error) {
+	return GetGitBackend().Fetch(token)
+}
+
+// AheadBehind counts commits on HEAD missing from upstreamRef (ahead) and
+// the reverse (behind), as of the last fetch.
+func AheadBehind() (int, int, error) {
+	return GetGitBackend().AheadBehind(upstreamRef())
+}
+
+// pushWithRetry pushes HEAD to the remote branch. When the push is rejected
+// because the remote moved, it fetches, checks the overlapping articles for
+// semantic conflicts, rebases the local commits and tries again, up to
+// config.PushRetries times.
+func pushWithRetry(token string, author *models.GitUser, result *models.PublishResult) (string, error) {
+	var logs []string
+	defer func() {
+		result.Ahead, result.Behind, _ = AheadBehind()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		result.Attempts = attempt
+		pushLog, err := GetGitBackend().Push(config.GitRemote, token)
+		logs = append(logs, fmt.Sprintf("[Attempt %d]\n%s", attempt, pushLog))
+		if err == nil {
+			result.Status = "ok"
+			logs = append(logs, pushMirrors(token, result)...)
+			return strings.Join(logs, "\n"), nil
+		}
+		if !isPushRejected(pushLog) || attempt > config.PushRetries {
+			return strings.Join(logs, "\n"), err
+		}
+		if !GitBinaryAvailable() {
+			logs = append(logs, "The remote branch moved; rebasing onto it needs git. Sync, then publish again.")
+			return strings.Join(logs, "\n"), ErrGitUnavailable
+		}
+
+		fetchLog, err := fetchUpstream(token)
+		logs = append(logs, "--- Fetch ---\n"+fetchLog)
+		if err != nil {
+			return strings.Join(logs, "\n"), err
+		}
+
+		base, err := runGit(nil, nil, "merge-base", "HEAD", upstreamRef())
+		if err != nil {
+			return strings.Join(logs, "\n"), err
+		}
+		if conflicts := semanticConflicts(strings.TrimSpace(base), "HEAD", upstreamRef()); len(conflicts) > 0 {
+			result.Status = "conflict"
+			result.Conflicts = conflicts
+			return strings.Join(logs, "\n"), ErrPushConflict
+		}
+
+		// Other editors' unsaved work is set aside, as rebase refuses to run
+		// over it (--autostash would leave conflicts of its own unreported)
+		if _, err := stashLocalChanges(); err != nil {
+			return strings.Join(logs, "\n"), err
+		}
+		// --rebase-merges keeps the merge commits of earlier syncs
+		rebaseLog, err := runGit(commitIdentityEnv(author), nil, "rebase", "--rebase-merges", upstreamRef())
+		logs = append(logs, "--- Rebase ---\n"+rebaseLog)
+		if err != nil {
+			files, _ := unmergedFiles()
+			runGit(nil, nil, "rebase", "--abort")
+			result.Status = "conflict"
+			result.Conflicts = files
+			logs = append(logs, err.Error())
+			if err := restoreLocalChanges(); err != nil {
+				logs = append(logs, err.Error())
+			}
+			return strings.Join(logs, "\n"), ErrPushConflict
+		}
+		if err := restoreLocalChanges(); err != nil {
+			// Left in conflict for /api/conflicts; the rebased commits are
+			// pushed once they are resolved
+			var conflictErr *MergeConflictError
+			if errors.As(err, &conflictErr) {
+				result.Status = "conflict"
+				result.Conflicts = conflictErr.Files
+			}
+			logs = append(logs, "Local changes conflict with the rebased commits: "+err.Error())
+			return strings.Join(logs, "\n"), err
+		}
+		if head, err := runGit(nil, nil, "rev-parse", "HEAD"); err == nil {
+			result.Commit = strings.TrimSpace(head)
+		}
+	}
+}
+
+// pushMirrors pushes the published commit to every config.GitMirrorRemotes.
+// A failing mirror is reported in result.Mirrors but doesn't fail the publish,
+// the primary remote already has the commit.
+func pushMirrors(token string, result *models.PublishResult) []string {
+	var logs []string
+	for _, mirror := range config.GitMirrorRemotes {
+		if result.Mirrors == nil {
+			result.Mirrors = make(map[string]string)
+		}
+		log, err := GetGitBackend().Push(mirror, token)
+		logs = append(logs, fmt.Sprintf("--- Mirror %s ---\n%s", mirror, log))
+		if err != nil {
+			fmt.Printf("[Git] Mirror push to %s failed: %v\n", mirror, err)
+			result.Mirrors[mirror] = err.Error()
+			continue
+		}
+		result.Mirrors[mirror] = "ok"
+	}
+	return logs
+}
+
+func changedFiles(from, to string) map[string]bool {
+	files := make(map[string]bool)
+	list, err := GetGitBackend().ChangedFiles(from, to)
+	if err != nil {
+		return files
+	}
+	for _, file := range list {
+		files[file] = true
+	}
+	return files
+}
+
+// semanticConflicts compares articles changed on both sides since base.
+// Front matter is compared field by field after the same normalization as
+// CheckSemanticDiff, so a textually clean merge that sets the same field to
+// two different values is still reported, while formatting-only differences
+// are not. Returned entries look like "content/posts/a.md (title, date)".
+func semanticConflicts(base, ours, theirs string) []string {
+	oursFiles := changedFiles(base, ours)
+	theirsFiles := changedFiles(base, theirs)
+
+	var conflicts []string
+	formats := currentContentFormats()
+	for file := range oursFiles {
+		if !theirsFiles[file] || !formats.isContentPage(file) {
+			continue
+		}
+
+		collection, _ := GetCollectionForPath(file)
+		load := func(rev string) (map[string]json.RawMessage, string, bool) {
+			content, err := runGit(nil, nil, "show", rev+":"+file)
+			if err != nil {
+				return nil, "", false
+			}
+			fmJSON, body, err := canonicalizeContentForDiff([]byte(content), collection)
+			fields := make(map[string]json.RawMessage)
+			if err == nil && len(fmJSON) > 0 {
+				json.Unmarshal(fmJSON, &fields)
+			}
+			return fields, body, true
+		}
+
+		baseFM, _, _ := load(base)
+		oursFM, _, oursExists := load(ours)
+		theirsFM, _, theirsExists := load(theirs)
+		if oursExists != theirsExists {
+			conflicts = append(conflicts, file+" (deleted on one side)")
+			continue
+		}
+
+		keys := make(map[string]bool)
+		for _, m := range []map[string]json.RawMessage{baseFM, oursFM, theirsFM} {
+			for k := range m {
+				keys[k] = true
+			}
+		}
+		var fields []string
+		for k := range keys {
+			b, o, t := string(baseFM[k]), string(oursFM[k]), string(theirsFM[k])
+			if o != b && t != b && o != t {
+				fields = append(fields, k)
+			}
+		}
+		if len(fields) > 0 {
+			sort.Strings(fields)
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s)", file, strings.Join(fields, ", ")))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"strings"
+	"sync"
+)
+
+// UnpushedCommits lists commits on HEAD that are not on the remote branch,
+// newest first, with the files each one touches.
+func UnpushedCommits() ([]models.UnpushedCommit, error) {
+	return GetGitBackend().CommitsSince(upstreamRef())
+}
+
+var (
+	unpushedMu    sync.Mutex
+	unpushedKey   string          // HEAD and upstreamRef unpushedFiles was listed for
+	unpushedFiles map[string]bool // Shared, never modified
+)
+
+// unpushedContentFiles returns the content-relative paths touched by
+// unpushed commits. The list is kept until HEAD or upstreamRef moves, as
+// the cache asks for every article it updates.
+func unpushedContentFiles() map[string]bool {
+	head, _ := GetGitBackend().Head()
+	upstream, err := GetGitBackend().ResolveRevision(upstreamRef())
+	if err != nil {
+		return map[string]bool{} // No remote-tracking ref yet
+	}
+	key := head + "..." + upstream
+
+	unpushedMu.Lock()
+	defer unpushedMu.Unlock()
+	if unpushedFiles != nil && key == unpushedKey {
+		return unpushedFiles
+	}
+	files := make(map[string]bool)
+	commits, err := UnpushedCommits()
+	if err != nil {
+		return files
+	}
+	for _, commit := range commits {
+		for _, file := range commit.Files {
+			if strings.HasPrefix(file, "content/") {
+				files[strings.TrimPrefix(file, "content/")] = true
+			}
+		}
+	}
+	unpushedKey, unpushedFiles = key, files
+	return files
+}
+
+// GetRemoteStatus reports how the local branch relates to the remote branch.
+// With a token the remote is fetched first; otherwise the last fetch is used.
+func GetRemoteStatus(token string) (*models.RemoteStatus, error) {
+	if token != "" {
+		if log, err := fetchUpstream(token); err != nil {
+			return nil, fmt.Errorf("fetch failed: %w: %s", err, log)
+		}
+	}
+
+	status := &models.RemoteStatus{
+		Remote:   config.GitRemote,
+		Branch:   config.GitBranch,
+		Unpushed: []models.UnpushedCommit{},
+		AutoSync: GetAutoSyncStatus(),
+	}
+	ahead, behind, err := AheadBehind()
+	if err != nil {
+		status.Error = "Remote branch has not been fetched yet"
+		return status, nil
+	}
+	status.Ahead, status.Behind = ahead, behind
+
+	if status.Unpushed, err = UnpushedCommits(); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// PushPending pushes commits left behind by an earlier failed push.
+func PushPending(token string, author *models.GitUser) (*models.PublishResult, error) {
+	result := &models.PublishResult{Status: "error", Files: []string{}}
+	if IsMerging() {
+		result.Log = "A sync is waiting for conflict resolution"
+		return result, &MergeConflictError{}
+	}
+
+	if head, err := GetGitBackend().Head(); err == nil {
+		result.Commit = head
+	}
+	log, err := pushWithRetry(token, author, result)
+	result.Log = log
+	if err == nil {
+		InvalidateCache()
+	}
+	return result, err
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRepoBusy is returned when the operation queue is full.
+	ErrRepoBusy = errors.New("repository is busy, too many queued operations")
+	// ErrOperationPending is returned for exclusive operations (e.g. sync)
+	// when the same operation is already queued.
+	ErrOperationPending = errors.New("the same operation is already queued")
+)
+
+// readOnlyGitEnv stops read-only commands such as `git status` from taking
+// index.lock to refresh the index, so they can run outside the queue.
+var readOnlyGitEnv = []string{"GIT_OPTIONAL_LOCKS=0"}
+
+// GitOperation describes a queued or running repository operation.
+type GitOperation struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	EnqueuedAt time.Time  `json:"enqueued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+}
+
+// RepoQueueStatus is a snapshot of the repository queue.
+type RepoQueueStatus struct {
+	Current    *GitOperation  `json:"current"`
+	Queue      []GitOperation `json:"queue"`
+	QueueDepth int            `json:"queue_depth"`
+	Merging    bool           `json:"merging"`
+}
+
+type queuedOperation struct {
+	info GitOperation
+	fn   func() error
+	done chan error
+}
+
+// Repository serializes operations that mutate the working tree or run
+// git commands against it, so concurrent editors never interleave
+// add/commit/push or collide on index.lock.
+type Repository struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*queuedOperation
+	current *queuedOperation
+	nextID  int64
+	start   sync.Once
+}
+
+// Repo is the repository shared by all handlers and background jobs.
+var Repo = NewRepository()
+
+func NewRepository() *Repository {
+	r := &Repository{}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// Run queues fn and blocks until it has been executed, returning its error.
+// Exclusive operations are rejected with ErrOperationPending while another
+// operation of the same name is queued; one may wait behind a running one.
+func (r *Repository) Run(name string, exclusive bool, fn func() error) error {
+	r.start.Do(func() { go r.worker() })
+
+	r.mu.Lock()
+	if exclusive {
+		// A running operation may have missed what triggered this one
+		// (e.g. a push during a sync), so only a queued one makes it redundant
+		for _, op := range r.pending {
+			if op.info.Name == name {
+				r.mu.Unlock()
+				return fmt.Errorf("%w: %s", ErrOperationPending, name)
+			}
+		}
+	}
+	if len(r.pending) >= config.GitQueueSize {
+		r.mu.Unlock()
+		return ErrRepoBusy
+	}
+
+	r.nextID++
+	op := &queuedOperation{
+		info: GitOperation{ID: r.nextID, Name: name, EnqueuedAt: time.Now()},
+		fn:   fn,
+		done: make(chan error, 1),
+	}
+	r.pending = append(r.pending, op)
+	r.cond.Signal()
+	r.mu.Unlock()
+
+	return <-op.done
+}
+
+func (r *Repository) worker() {
+	for {
+		r.mu.Lock()
+		for len(r.pending) == 0 {
+			r.cond.Wait()
+		}
+		op := r.pending[0]
+		r.pending = r.pending[1:]
+		started := time.Now()
+		op.info.StartedAt = &started
+		r.current = op
+		r.mu.Unlock()
+
+		err := runOperation(op)
+		fmt.Printf("[Repo] Op: %s (#%d), Waited: %v, Duration: %v\n", op.info.Name, op.info.ID, started.Sub(op.info.EnqueuedAt), time.Since(started))
+
+		r.mu.Lock()
+		r.current = nil
+		r.mu.Unlock()
+		op.done <- err
+	}
+}
+
+// runOperation keeps the worker alive if an operation panics.
+func runOperation(op *queuedOperation) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("operation %s panicked: %v", op.info.Name, p)
+		}
+	}()
+	return op.fn()
+}
+
+// Status returns the running operation and the pending queue.
+func (r *Repository) Status() RepoQueueStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := RepoQueueStatus{Queue: []GitOperation{}, QueueDepth: len(r.pending)}
+	if r.current != nil {
+		current := r.current.info
+		status.Current = &current
+	}
+	for _, op := range r.pending {
+		status.Queue = append(status.Queue, op.info)
+	}
+	status.Merging = IsMerging()
+	return status
+}
@@ -0,0 +1,589 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+	// Runes of context shown around the first match
+	snippetRadius = 60
+)
+
+// Ranking weight of a match by field; other front matter fields get
+// frontMatterSearchWeight.
+var searchFieldWeights = map[string]float64{"title": 3, "body": 1}
+
+const frontMatterSearchWeight = 2
+
+// searchPosting records that a document contains a token count times in a
+// field (an index into searchIndex.fields).
+type searchPosting struct {
+	doc   int32
+	field uint16
+	count uint16
+}
+
+type searchDoc struct {
+	path    string // Slash-separated, content-relative
+	title   string
+	modTime int64
+	size    int64
+	tokens  []string // Distinct tokens, to drop the postings again
+}
+
+// searchIndex is an in-memory inverted index over the title, body and
+// string front matter of every article. It is built on the first search,
+// updated with UpdateCache and rescanned (only changed files are read)
+// after InvalidateCache.
+type searchIndex struct {
+	mu       sync.RWMutex
+	docs     map[int32]*searchDoc
+	docIDs   map[string]int32
+	nextID   int32
+	postings map[string][]searchPosting
+	df       map[string]int // Documents per token
+	fields   []string
+	fieldIDs map[string]uint16
+	stale    bool
+}
+
+var articleSearch = &searchIndex{
+	docs:     map[int32]*searchDoc{},
+	docIDs:   map[string]int32{},
+	postings: map[string][]searchPosting{},
+	df:       map[string]int{},
+	fieldIDs: map[string]uint16{},
+	stale:    true,
+}
+
+// indexedSearchDoc is a document tokenized outside the lock.
+type indexedSearchDoc struct {
+	doc    searchDoc
+	counts map[string]map[string]int // Field -> token -> count
+}
+
+// SearchArticles returns the articles matching every word of query, best
+// first. Words are matched whole; CJK text, which has no spaces, is matched
+// by overlapping character pairs.
+func SearchArticles(query string, limit int) (models.SearchResult, error) {
+	result := models.SearchResult{Query: query, Hits: []models.SearchHit{}}
+	if err := articleSearch.refresh(); err != nil {
+		return result, err
+	}
+
+	s := articleSearch
+	s.mu.RLock()
+	tokens := searchTokens(query, true)
+	if len(tokens) == 0 {
+		s.mu.RUnlock()
+		return result, nil
+	}
+	// Start with the rarest token; every other one must occur too
+	sort.Slice(tokens, func(i, j int) bool { return s.df[tokens[i]] < s.df[tokens[j]] })
+
+	n := float64(len(s.docs))
+	scores := map[int32]float64{}
+	fieldScores := map[int32]map[uint16]float64{}
+	for i, token := range tokens {
+		idf := math.Log(1 + n/float64(max(s.df[token], 1)))
+		seen := map[int32]bool{}
+		for _, p := range s.postings[token] {
+			if _, ok := scores[p.doc]; !ok && i > 0 {
+				continue // Missed an earlier token
+			}
+			w := idf * (1 + math.Log(float64(p.count))) * s.fieldWeight(p.field)
+			scores[p.doc] += w
+			if fieldScores[p.doc] == nil {
+				fieldScores[p.doc] = map[uint16]float64{}
+			}
+			fieldScores[p.doc][p.field] += w
+			seen[p.doc] = true
+		}
+		for doc := range scores {
+			if !seen[doc] {
+				delete(scores, doc)
+			}
+		}
+		if len(scores) == 0 {
+			break
+		}
+	}
+
+	hits := make([]models.SearchHit, 0, len(scores))
+	for id, score := range scores {
+		doc := s.docs[id]
+		best, bestScore := "", -1.0
+		for field, w := range fieldScores[id] {
+			if w > bestScore || (w == bestScore && s.fields[field] < best) {
+				best, bestScore = s.fields[field], w
+			}
+		}
+		hits = append(hits, models.SearchHit{
+			Path:  filepath.FromSlash(doc.path),
+			Title: doc.title,
+			Field: best,
+			Score: math.Round(score*1000) / 1000,
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Path < hits[j].Path
+	})
+	result.Total = len(hits)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	terms := searchTerms(query)
+	for i := range hits {
+		content, err := os.ReadFile(filepath.Join(config.RepoPath, "content", hits[i].Path))
+		if err != nil {
+			continue
+		}
+		_, fields := searchFields(content)
+		hits[i].Snippet = searchSnippet(fields[hits[i].Field], terms)
+	}
+	result.Hits = hits
+	return result, nil
+}
+
+func (s *searchIndex) fieldWeight(field uint16) float64 {
+	if w, ok := searchFieldWeights[s.fields[field]]; ok {
+		return w
+	}
+	return frontMatterSearchWeight
+}
+
+// refresh rescans content/ if the index is stale, reading only files whose
+// mtime or size changed.
+func (s *searchIndex) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stale {
+		return nil
+	}
+
+	start := time.Now()
+	contentDir := filepath.Join(config.RepoPath, "content")
+	present := map[string]bool{}
+	var changed []string
+	formats := currentContentFormats()
+	err := filepath.WalkDir(contentDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !formats.isContent(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while walking
+		}
+		rel, _ := filepath.Rel(contentDir, path)
+		rel = filepath.ToSlash(rel)
+		present[rel] = true
+		if id, ok := s.docIDs[rel]; ok && s.docs[id].modTime == info.ModTime().UnixNano() && s.docs[id].size == info.Size() {
+			return nil
+		}
+		changed = append(changed, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for rel := range s.docIDs {
+		if !present[rel] {
+			s.remove(rel)
+		}
+	}
+
+	indexed := make([]*indexedSearchDoc, len(changed))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, config.CacheConcurrency)
+	for i, rel := range changed {
+		wg.Add(1)
+		go func(i int, rel string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			indexed[i] = readSearchDoc(rel)
+		}(i, rel)
+	}
+	wg.Wait()
+	for i, rel := range changed {
+		s.remove(rel)
+		if indexed[i] != nil {
+			s.add(indexed[i])
+		}
+	}
+
+	s.stale = false
+	fmt.Printf("[Search] Indexed %d article(s), %d re-read in %v\n", len(s.docs), len(changed), time.Since(start))
+	return nil
+}
+
+// readSearchDoc reads and tokenizes the content-relative rel, or returns
+// nil if it can't be read.
+func readSearchDoc(rel string) *indexedSearchDoc {
+	fullPath := filepath.Join(config.RepoPath, "content", filepath.FromSlash(rel))
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil
+	}
+
+	title, fields := searchFields(content)
+	if title == "" {
+		title = filepath.FromSlash(rel)
+	}
+	doc := &indexedSearchDoc{
+		doc: searchDoc{
+			path:    rel,
+			title:   title,
+			modTime: info.ModTime().UnixNano(),
+			size:    info.Size(),
+		},
+		counts: map[string]map[string]int{},
+	}
+	for field, text := range fields {
+		counts := map[string]int{}
+		for _, token := range searchTokens(text, false) {
+			counts[token]++
+		}
+		if len(counts) > 0 {
+			doc.counts[field] = counts
+		}
+	}
+	return doc
+}
+
+// add inserts a tokenized document. Called with s.mu held.
+func (s *searchIndex) add(d *indexedSearchDoc) {
+	id := s.nextID
+	s.nextID++
+	doc := d.doc
+	distinct := map[string]bool{}
+	for field, counts := range d.counts {
+		fieldID, ok := s.fieldIDs[field]
+		if !ok {
+			fieldID = uint16(len(s.fields))
+			s.fields = append(s.fields, field)
+			s.fieldIDs[field] = fieldID
+		}
+		for token, count := range counts {
+			s.postings[token] = append(s.postings[token], searchPosting{doc: id, field: fieldID, count: uint16(min(count, math.MaxUint16))})
+			if !distinct[token] {
+				distinct[token] = true
+				s.df[token]++
+				doc.tokens = append(doc.tokens, token)
+			}
+		}
+	}
+	s.docs[id] = &doc
+	s.docIDs[doc.path] = id
+}
+
+// remove drops the document of the content-relative rel, if indexed.
+// Called with s.mu held.
+func (s *searchIndex) remove(rel string) {
+	id, ok := s.docIDs[rel]
+	if !ok {
+		return
+	}
+	for _, token := range s.docs[id].tokens {
+		postings := s.postings[token]
+		kept := postings[:0]
+		for _, p := range postings {
+			if p.doc != id {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.postings, token)
+			delete(s.df, token)
+		} else {
+			s.postings[token] = kept
+			s.df[token]--
+		}
+	}
+	delete(s.docs, id)
+	delete(s.docIDs, rel)
+}
+
+// updateSearchIndex re-indexes the content-relative relPath after a change,
+// or drops it (and, for a directory, everything below it) once removed.
+func updateSearchIndex(relPath string) {
+	rel := filepath.ToSlash(relPath)
+	s := articleSearch
+	s.mu.RLock()
+	stale := s.stale
+	s.mu.RUnlock()
+	if stale {
+		return // The next search rescans anyway
+	}
+
+	fullPath := filepath.Join(config.RepoPath, "content", filepath.FromSlash(rel))
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		return // Its files are updated one by one
+	}
+	doc := readSearchDoc(rel)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc != nil {
+		s.remove(rel)
+		s.add(doc)
+		return
+	}
+	s.remove(rel)
+	prefix := rel + "/"
+	for path := range s.docIDs {
+		if strings.HasPrefix(path, prefix) {
+			s.remove(path)
+		}
+	}
+}
+
+// invalidateSearchIndex makes the next search rescan content/.
+func invalidateSearchIndex() {
+	articleSearch.mu.Lock()
+	articleSearch.stale = true
+	articleSearch.mu.Unlock()
+}
+
+// searchFields returns the title and the searchable text of an article by
+// field: "title", "body" and string front matter by lowercased key.
+func searchFields(content []byte) (string, map[string]string) {
+	fields := map[string]string{}
+	fm, body, _, err := ParseFrontMatter(content)
+	if err != nil {
+		fields["body"] = string(content)
+		return "", fields
+	}
+	fields["body"] = body
+
+	title := ""
+	for key, value := range fm {
+		key = strings.ToLower(key)
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					items = append(items, s)
+				}
+			}
+			text = strings.Join(items, ", ")
+		}
+		if text == "" || isDateParam(key) {
+			continue
+		}
+		if key == "title" {
+			title = text
+		}
+		fields[key] = text
+	}
+	return title, fields
+}
+
+func isDateParam(key string) bool {
+	for _, p := range dateParams {
+		if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// isCJK reports whether r belongs to a script written without spaces
+// between words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r == 'ー' // Prolonged sound mark, common to hiragana and katakana
+}
+
+// searchTokens splits text into lowercased tokens after NFKC normalization
+// (which folds full-width Latin and half-width kana). Runs of other letters
+// and digits are words; CJK runs become overlapping bigrams, plus single
+// characters when indexing so one-character queries match. For a query, a
+// lone CJK character is kept as is and the tokens are distinct.
+func searchTokens(text string, query bool) []string {
+	var tokens []string
+	var word, cjk []rune
+	seen := map[string]bool{}
+	emit := func(token string) {
+		if query {
+			if seen[token] {
+				return
+			}
+			seen[token] = true
+		}
+		tokens = append(tokens, token)
+	}
+	flushWord := func() {
+		if len(word) > 0 {
+			emit(string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			emit(string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				emit(string(cjk[i : i+2]))
+			}
+			if !query {
+				for _, r := range cjk {
+					emit(string(r))
+				}
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range norm.NFKC.String(text) {
+		r = unicode.ToLower(r)
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// searchTerms returns the words and CJK runs of a query, lowercased, to
+// highlight in snippets.
+func searchTerms(query string) [][]rune {
+	var terms [][]rune
+	var current []rune
+	currentCJK := false
+	flush := func() {
+		if len(current) > 0 {
+			terms = append(terms, current)
+		}
+		current = nil
+	}
+	for _, r := range norm.NFKC.String(query) {
+		r = unicode.ToLower(r)
+		cjk := isCJK(r)
+		if !cjk && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) {
+			flush()
+			continue
+		}
+		if len(current) > 0 && cjk != currentCJK {
+			flush()
+		}
+		current = append(current, r)
+		currentCJK = cjk
+	}
+	flush()
+	// Longest first, so overlapping terms highlight the longer one
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	return terms
+}
+
+// searchSnippet returns an HTML-escaped excerpt of text around the first
+// occurrence of a term, with every occurrence wrapped in <mark>.
+func searchSnippet(text string, terms [][]rune) string {
+	runes := []rune(strings.Join(strings.Fields(norm.NFKC.String(text)), " "))
+	folded := make([]rune, len(runes))
+	for i, r := range runes {
+		folded[i] = unicode.ToLower(r)
+	}
+
+	// Matched ranges, left to right, not overlapping
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(folded); {
+		matched := 0
+		for _, term := range terms {
+			if hasRunePrefix(folded[i:], term) {
+				matched = len(term)
+				break
+			}
+		}
+		if matched > 0 {
+			spans = append(spans, span{i, i + matched})
+			i += matched
+		} else {
+			i++
+		}
+	}
+
+	start, end := 0, min(len(runes), 2*snippetRadius)
+	if len(spans) > 0 {
+		start = max(0, spans[0].start-snippetRadius)
+		end = min(len(runes), spans[0].end+snippetRadius)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, sp := range spans {
+		if sp.end <= start || sp.start >= end {
+			continue
+		}
+		s, e := max(sp.start, start), min(sp.end, end)
+		b.WriteString(html.EscapeString(string(runes[pos:s])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[s:e])))
+		b.WriteString("</mark>")
+		pos = e
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
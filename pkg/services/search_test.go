@@ -0,0 +1,68 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query bool
+		want  []string
+	}{
+		{"words", "Hello, World! 2024", false, []string{"hello", "world", "2024"}},
+		{"punctuation only", " -- ... ", false, nil},
+		{"full-width latin", "ＨＵＧＯ ＣＭＳ", false, []string{"hugo", "cms"}},
+		{"half-width kana", "ｶﾀｶﾅ", false, []string{"カタ", "タカ", "カナ", "カ", "タ", "カ", "ナ"}},
+		{"combining marks", "café", false, []string{"café"}},
+		{"cjk bigrams and characters", "東京都", false, []string{"東京", "京都", "東", "京", "都"}},
+		{"single cjk character", "猫", false, []string{"猫"}},
+		{"cjk between words", "Go言語 test", false, []string{"go", "言語", "言", "語", "test"}},
+		{"prolonged sound mark", "ラーメン", true, []string{"ラー", "ーメ", "メン"}},
+		{"query bigrams only", "東京都", true, []string{"東京", "京都"}},
+		{"query single cjk character", "猫", true, []string{"猫"}},
+		{"query distinct tokens", "go Go GO 東京東京", true, []string{"go", "東京", "京東"}},
+		{"text keeps repeats", "go Go", false, []string{"go", "go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTokens(tt.text, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchTokens(%q, %v) = %q, want %q", tt.text, tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("a", 100) + " needle " + strings.Repeat("b", 100)
+
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{"no match", "Nothing to see here", "needle", "Nothing to see here"},
+		{"no match truncated", strings.Repeat("x", 150), "needle", strings.Repeat("x", 2*snippetRadius) + "…"},
+		{"every occurrence", "Go is fun, go on", "go", "<mark>Go</mark> is fun, <mark>go</mark> on"},
+		{"longer term first", "Hugo and Hug", "hug hugo", "<mark>Hugo</mark> and <mark>Hug</mark>"},
+		{"collapses whitespace", "a\n\n  needle\tb", "needle", "a <mark>needle</mark> b"},
+		{"escapes html", "<b>needle</b> & co", "needle", "&lt;b&gt;<mark>needle</mark>&lt;/b&gt; &amp; co"},
+		{"full-width text", "ＨＵＧＯ rocks", "hugo", "<mark>HUGO</mark> rocks"},
+		{"cjk run", "今日は東京都に行く", "東京都", "今日は<mark>東京都</mark>に行く"},
+		{
+			"window around first match", long, "needle",
+			"…" + strings.Repeat("a", snippetRadius-1) + " <mark>needle</mark> " + strings.Repeat("b", snippetRadius-1) + "…",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchSnippet(tt.text, searchTerms(tt.query)); got != tt.want {
+				t.Errorf("searchSnippet(%q, %q) = %q, want %q", tt.text, tt.query, got, tt.want)
+			}
+		})
+	}
+}
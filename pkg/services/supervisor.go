@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"hugo-cms/pkg/models"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Supervisor states.
+const (
+	ProcessStarting  = "starting"
+	ProcessRunning   = "running"
+	ProcessUnhealthy = "unhealthy"
+	ProcessBackoff   = "backoff"
+	ProcessStopped   = "stopped"
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+	healthInterval    = 5 * time.Second
+	// Time a fresh process gets for its first build before health checks count
+	startupGrace = 60 * time.Second
+	// Consecutive failed checks before the process is restarted
+	maxHealthFailures = 3
+	stopTimeout       = 5 * time.Second
+)
+
+// LogBuffer keeps the last lines written to it.
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &LogBuffer{lines: make([]string, size)}
+}
+
+func (b *LogBuffer) Add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines returns the buffered lines, oldest first.
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]string{}, b.lines[:b.next]...)
+	}
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// ProcessSupervisor keeps a long-running child process (hugo server) alive:
+// it restarts the process with exponential backoff when it exits or stops
+// answering on its port, and captures its output.
+type ProcessSupervisor struct {
+	Name string
+	Addr string // host:port probed by the health check
+	// Command builds the command for each (re)start
+	Command func() *exec.Cmd
+	// OnLine, if set, receives every output line of the process
+	OnLine func(line string)
+
+	mu        sync.Mutex
+	logs      *LogBuffer
+	started   bool
+	cmd       *exec.Cmd
+	state     string
+	startedAt time.Time
+	restarts  int
+	lastExit  string
+	lastCheck time.Time
+	healthy   bool
+	failures  int
+	restartCh chan struct{}
+	stopCh    chan struct{}
+	done      chan struct{}
+}
+
+func NewProcessSupervisor(name, addr string, logLines int, command func() *exec.Cmd) *ProcessSupervisor {
+	return &ProcessSupervisor{
+		Name:      name,
+		Addr:      addr,
+		Command:   command,
+		logs:      NewLogBuffer(logLines),
+		state:     ProcessStopped,
+		restartCh: make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start launches the supervision loop once.
+func (s *ProcessSupervisor) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	go s.run()
+	go s.healthLoop()
+}
+
+// Restart asks the loop to restart the process right away.
+func (s *ProcessSupervisor) Restart() {
+	select {
+	case s.restartCh <- struct{}{}:
+	default: // A restart is already pending
+	}
+}
+
+// Stop terminates the process and waits for the loop to finish.
+func (s *ProcessSupervisor) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	select {
+	case <-s.stopCh:
+	default:
+		close(s.stopCh)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *ProcessSupervisor) Logs() []string {
+	return s.logs.Lines()
+}
+
+func (s *ProcessSupervisor) Status() models.ProcessStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := models.ProcessStatus{
+		Name:      s.Name,
+		State:     s.state,
+		Addr:      s.Addr,
+		Restarts:  s.restarts,
+		LastExit:  s.lastExit,
+		Healthy:   s.healthy,
+		LastCheck: s.lastCheck,
+		Logs:      s.logs.Lines(),
+	}
+	if s.cmd != nil && s.cmd.Process != nil {
+		status.PID = s.cmd.Process.Pid
+		status.StartedAt = s.startedAt
+	}
+	return status
+}
+
+func (s *ProcessSupervisor) startedAtTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startedAt
+}
+
+func (s *ProcessSupervisor) setState(state string) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+func (s *ProcessSupervisor) run() {
+	defer close(s.done)
+	backoff := minRestartBackoff
+
+	for {
+		cmd := s.Command()
+		out := &lineWriter{onLine: s.handleLine}
+		cmd.Stdout = out
+		cmd.Stderr = out
+
+		fmt.Printf("[%s] Starting: %v\n", s.Name, cmd.Args)
+		s.mu.Lock()
+		err := cmd.Start()
+		if err == nil {
+			s.cmd = cmd
+			s.state = ProcessStarting
+			s.startedAt = time.Now()
+			s.healthy = false
+			s.failures = 0
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			s.handleLine(fmt.Sprintf("failed to start: %v", err))
+			s.mu.Lock()
+			s.lastExit = err.Error()
+			s.mu.Unlock()
+		} else {
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+
+			select {
+			case err := <-exited:
+				out.Flush()
+				s.recordExit(err)
+				// A process that stayed up for a while starts over with a short delay
+				if time.Since(s.startedAtTime()) > maxRestartBackoff {
+					backoff = minRestartBackoff
+				}
+			case <-s.restartCh:
+				s.handleLine("restart requested")
+				s.recordExit(terminate(cmd, exited))
+				backoff = minRestartBackoff
+				s.mu.Lock()
+				s.restarts++
+				s.mu.Unlock()
+				continue
+			case <-s.stopCh:
+				s.recordExit(terminate(cmd, exited))
+				s.setState(ProcessStopped)
+				return
+			}
+		}
+
+		// Crashed or failed to start: wait, then try again
+		s.setState(ProcessBackoff)
+		fmt.Printf("[%s] Restarting in %v\n", s.Name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-s.restartCh:
+		case <-s.stopCh:
+			s.setState(ProcessStopped)
+			return
+		}
+		if backoff *= 2; backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+	}
+}
+
+func (s *ProcessSupervisor) recordExit(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastExit = "exited normally"
+	if err != nil {
+		s.lastExit = err.Error()
+	}
+	s.cmd = nil
+	s.healthy = false
+	fmt.Printf("[%s] Stopped: %s\n", s.Name, s.lastExit)
+}
+
+func (s *ProcessSupervisor) handleLine(line string) {
+	fmt.Fprintln(os.Stdout, line)
+	s.logs.Add(line)
+	if s.OnLine != nil {
+		s.OnLine(line)
+	}
+}
+
+// healthLoop probes Addr and restarts a process that stopped answering.
+func (s *ProcessSupervisor) healthLoop() {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		running := s.cmd != nil
+		startedAt := s.startedAt
+		s.mu.Unlock()
+		if !running {
+			continue
+		}
+
+		conn, err := net.DialTimeout("tcp", s.Addr, 2*time.Second)
+		if err == nil {
+			conn.Close()
+		}
+
+		s.mu.Lock()
+		s.lastCheck = time.Now()
+		s.healthy = err == nil
+		switch {
+		case err == nil:
+			s.failures = 0
+			s.state = ProcessRunning
+		case time.Since(startedAt) > startupGrace:
+			s.failures++
+			s.state = ProcessUnhealthy
+		}
+		restart := s.failures >= maxHealthFailures
+		if restart {
+			s.failures = 0
+		}
+		s.mu.Unlock()
+
+		if restart {
+			fmt.Printf("[%s] Not answering on %s, restarting\n", s.Name, s.Addr)
+			s.Restart()
+		}
+	}
+}
+
+// terminate stops cmd gracefully, killing it if it doesn't exit in time.
+func terminate(cmd *exec.Cmd, exited <-chan error) error {
+	// SIGTERM is not supported on Windows; Kill is the only option there
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(stopTimeout):
+		cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+// lineWriter splits process output into lines.
+type lineWriter struct {
+	mu      sync.Mutex
+	partial []byte
+	onLine  func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(string(bytes.TrimRight(w.partial[:i], "\r")))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits an unterminated last line.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.onLine(string(w.partial))
+		w.partial = nil
+	}
+}
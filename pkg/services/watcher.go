@@ -0,0 +1,254 @@
+package services
+
+import (
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Directories below RepoPath kept in sync by the watcher
+var watchedDirs = []string{"content", "static"}
+
+// Batches touching more articles than this rebuild the whole cache instead
+// (e.g. a pull or checkout), which is cheaper than a git status per file.
+const watchBatchLimit = 50
+
+var (
+	watcherMu  sync.Mutex
+	watcher    *fsnotify.Watcher
+	fileEvents = newEventHub[models.FileChange]()
+)
+
+// StartWatcher watches content/ and static/ for changes made outside the
+// CMS, updates the article cache and notifies editors.
+func StartWatcher() {
+	if !config.FileWatcher {
+		return
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("[Watcher] Failed to start: %v\n", err)
+		return
+	}
+
+	for _, dir := range watchedDirs {
+		root := filepath.Join(config.RepoPath, dir)
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		if err := addWatchTree(w, root, nil); err != nil {
+			fmt.Printf("[Watcher] Failed to watch %s: %v\n", dir, err)
+		}
+	}
+	// New top-level directories (e.g. a first static/) are picked up too
+	if err := w.Add(config.RepoPath); err != nil {
+		fmt.Printf("[Watcher] Failed to watch %s: %v\n", config.RepoPath, err)
+	}
+
+	watcherMu.Lock()
+	watcher = w
+	watcherMu.Unlock()
+
+	fmt.Printf("[Watcher] Watching %s (debounce %v)\n", strings.Join(watchedDirs, ", "), config.WatchDebounce)
+	go watchLoop(w)
+}
+
+// StopWatcher stops the watcher, e.g. on shutdown.
+func StopWatcher() {
+	watcherMu.Lock()
+	defer watcherMu.Unlock()
+	if watcher != nil {
+		watcher.Close()
+		watcher = nil
+	}
+}
+
+// SubscribeFileEvents returns a stream of file changes and a function that
+// ends the subscription. The channel is closed by CloseEventStreams.
+func SubscribeFileEvents() (<-chan models.FileChange, func()) {
+	fileEvents.mu.Lock()
+	defer fileEvents.mu.Unlock()
+	return fileEvents.subscribe(nil)
+}
+
+// addWatchTree watches root and the directories below it. Files found are
+// added to pending, if given: they may have been written before the watch
+// was in place.
+func addWatchTree(w *fsnotify.Watcher, root string, pending map[string]bool) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Removed again while walking
+		}
+		if path != root && ignoredWatchPath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return w.Add(path)
+		}
+		if pending != nil {
+			if rel, ok := watchedRelPath(path); ok {
+				pending[rel] = true
+			}
+		}
+		return nil
+	})
+}
+
+// removeWatchTree drops the watches of a directory that was removed or moved
+// away, including those below it: a moved directory keeps reporting events
+// under its old path otherwise.
+func removeWatchTree(w *fsnotify.Watcher, root string) {
+	prefix := root + string(filepath.Separator)
+	for _, path := range w.WatchList() {
+		if path == root || strings.HasPrefix(path, prefix) {
+			w.Remove(path)
+		}
+	}
+}
+
+// ignoredWatchPath reports whether path is a hidden or editor temporary file.
+func ignoredWatchPath(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") ||
+		strings.HasSuffix(name, ".swx") ||
+		(strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"))
+}
+
+// watchedRelPath returns the repo-relative, slash-separated form of path if
+// it lies below one of watchedDirs.
+func watchedRelPath(path string) (string, bool) {
+	rel, err := filepath.Rel(config.RepoPath, path)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, dir := range watchedDirs {
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+func watchLoop(w *fsnotify.Watcher) {
+	pending := map[string]bool{}
+	var timer *time.Timer
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod || ignoredWatchPath(ev.Name) {
+				continue
+			}
+			if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				removeWatchTree(w, ev.Name)
+			}
+
+			rel, ok := watchedRelPath(ev.Name)
+			if !ok {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					addWatchTree(w, ev.Name, pending)
+				}
+			}
+			pending[rel] = true
+
+			// Wait until things are quiet, so a pull is handled as one batch
+			if timer == nil {
+				timer = time.NewTimer(config.WatchDebounce)
+			} else {
+				timer.Reset(config.WatchDebounce)
+			}
+			flush = timer.C
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			// E.g. the kernel's event queue overflowed: changes were lost
+			fmt.Printf("[Watcher] %v, reloading cache\n", err)
+			InvalidateCache()
+			markDraftPreviewsStale()
+		case <-flush:
+			flush = nil
+			applyFileChanges(pending)
+			pending = map[string]bool{}
+		}
+	}
+}
+
+// applyFileChanges updates the cache entries of the changed paths (repo
+// relative) and notifies editors.
+func applyFileChanges(paths map[string]bool) {
+	change := models.FileChange{Time: time.Now()}
+	var articles []string
+	for rel := range paths {
+		info, err := os.Stat(filepath.Join(config.RepoPath, filepath.FromSlash(rel)))
+		switch {
+		case err != nil:
+			change.Removed = append(change.Removed, rel)
+		case info.IsDir():
+			continue // Its files were queued when it was created
+		default:
+			change.Changed = append(change.Changed, rel)
+		}
+		if strings.HasPrefix(rel, "content/") {
+			articles = append(articles, rel)
+		}
+	}
+	if len(change.Changed) == 0 && len(change.Removed) == 0 {
+		return
+	}
+	sort.Strings(change.Changed)
+	sort.Strings(change.Removed)
+	fmt.Printf("[Watcher] %d changed, %d removed\n", len(change.Changed), len(change.Removed))
+	// Draft previews may be busy rebuilding; don't hold up the watcher
+	go syncDraftPreviews(append(append([]string{}, change.Changed...), change.Removed...))
+
+	if len(articles) > watchBatchLimit {
+		InvalidateCache()
+	} else {
+		formats := currentContentFormats()
+		for _, rel := range change.Changed {
+			switch {
+			case formats.isContentPage(rel):
+				UpdateCache(filepath.FromSlash(strings.TrimPrefix(rel, "content/")))
+			case strings.HasPrefix(rel, "content/") && formats.hasExtension(rel):
+				// An HTML file whose front matter was removed
+				removeCacheEntries(filepath.FromSlash(strings.TrimPrefix(rel, "content/")))
+			}
+		}
+		for _, rel := range change.Removed {
+			switch {
+			case rel == "content":
+				InvalidateCache()
+			case strings.HasPrefix(rel, "content/"):
+				// May have been a directory full of articles
+				removeCacheEntries(filepath.FromSlash(strings.TrimPrefix(rel, "content/")))
+			}
+		}
+	}
+
+	fileEvents.mu.Lock()
+	fileEvents.publish(change)
+	fileEvents.mu.Unlock()
+}
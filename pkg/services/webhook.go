@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"strings"
+	"sync"
+)
+
+// Number of webhook delivery IDs remembered to ignore redeliveries.
+const maxRecordedDeliveries = 500
+
+var (
+	deliveriesMu    sync.Mutex
+	deliveriesSeen  = make(map[string]bool)
+	deliveriesOrder []string
+)
+
+// VerifyWebhookSignature checks an X-Hub-Signature-256 header ("sha256=<hex>")
+// against the HMAC of the raw payload.
+func VerifyWebhookSignature(payload []byte, header string) bool {
+	if config.GitHubWebhookSecret == "" || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(config.GitHubWebhookSecret))
+	mac.Write(payload)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// RecordDelivery remembers a delivery ID and reports whether it is new.
+func RecordDelivery(id string) bool {
+	if id == "" {
+		return true
+	}
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	if deliveriesSeen[id] {
+		return false
+	}
+	deliveriesSeen[id] = true
+	deliveriesOrder = append(deliveriesOrder, id)
+	if len(deliveriesOrder) > maxRecordedDeliveries {
+		delete(deliveriesSeen, deliveriesOrder[0])
+		deliveriesOrder = deliveriesOrder[1:]
+	}
+	return true
+}
+
+// SyncFromWebhook runs SyncRepo with the server credential through the
+// repository queue. It is a no-op while another sync is queued; behind a
+// running one it runs again, as that may have fetched before the push.
+func SyncFromWebhook(deliveryID string) error {
+	err := Repo.Run("sync", true, func() error {
+		log, err := SyncRepo(ServerToken(), nil)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(log))
+		}
+		return nil
+	})
+	if errors.Is(err, ErrOperationPending) {
+		fmt.Printf("[Webhook] Delivery %s: sync already pending\n", deliveryID)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"hugo-cms/pkg/models"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Workflow statuses, named after the Decap CMS editorial workflow so that
+// pull requests opened by either tool are understood by the other.
+const (
+	WorkflowDraft          = "draft"
+	WorkflowPendingReview  = "pending_review"
+	WorkflowPendingPublish = "pending_publish"
+
+	workflowBranchPrefix = "cms/"
+	workflowLabelPrefix  = "decap-cms/"
+)
+
+var branchUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WorkflowSlug derives the entry slug, "<section>/<name>" like Decap CMS's
+// "<collection>/<slug>", from a content-relative article path. Every slug
+// has exactly two parts, as git can't hold both cms/posts and cms/posts/foo:
+// deeper paths are flattened with hyphens, leaf bundles ("posts/foo/index.md")
+// use their directory name, section pages are named "_index" and top-level
+// pages, the home page included, are in the section "_root".
+func WorkflowSlug(relPath string) string {
+	relPath = path.Clean(filepath.ToSlash(relPath))
+	name := strings.TrimSuffix(relPath, path.Ext(relPath))
+	if path.Base(name) == "index" && path.Dir(name) != "." {
+		name = path.Dir(name)
+	}
+	section := "_root"
+	if dir, rest, ok := strings.Cut(name, "/"); ok {
+		section, name = dir, strings.ReplaceAll(rest, "/", "-")
+	}
+	return slugPart(section, relPath) + "/" + slugPart(name, relPath)
+}
+
+// slugPart makes s a valid ref name component. One left without any safe
+// character (e.g. a title in Japanese) is named after a hash of relPath.
+func slugPart(s, relPath string) string {
+	s = branchUnsafeChars.ReplaceAllString(s, "-")
+	for strings.Contains(s, "..") {
+		s = strings.ReplaceAll(s, "..", ".")
+	}
+	s = strings.Trim(strings.TrimSuffix(s, ".lock"), ".-")
+	if s == "" {
+		sum := sha256.Sum256([]byte(relPath))
+		return hex.EncodeToString(sum[:])[:12]
+	}
+	return s
+}
+
+func WorkflowBranch(relPath string) string {
+	return workflowBranchPrefix + WorkflowSlug(relPath)
+}
+
+func isValidWorkflowStatus(status string) bool {
+	switch status {
+	case WorkflowDraft, WorkflowPendingReview, WorkflowPendingPublish:
+		return true
+	}
+	return false
+}
+
+// workflowFiles lists the repo-relative files that belong to an article:
+// for leaf bundles the files of its directory that differ from HEAD, as git
+// status reports them (deletions included, ignored files not), plus those
+// on HEAD and on parent, so changes reverted since the last save are
+// carried over; otherwise just the file itself.
+func workflowFiles(relPath, parent string) ([]string, error) {
+	repoRel := filepath.ToSlash(filepath.Join("content", relPath))
+	if !isBundleIndex(relPath) {
+		return []string{repoRel}, nil
+	}
+
+	bundleDir := path.Dir(repoRel)
+	status, err := GetGitBackend().Status(bundleDir)
+	if err != nil {
+		return nil, err
+	}
+	var committed []string
+	for _, rev := range []string{"HEAD", parent} {
+		out, err := runGit(nil, nil, "ls-tree", "-r", "--name-only", rev, "--", bundleDir+"/")
+		if err != nil {
+			return nil, err
+		}
+		committed = append(committed, strings.Split(out, "\n")...)
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	add := func(file string) {
+		if file != "" && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, entry := range status {
+		add(entry.Path)
+		add(entry.OldPath)
+	}
+	for _, file := range committed {
+		add(strings.TrimSpace(file))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func refExists(ref string) bool {
+	return GetGitBackend().RevisionExists(ref)
+}
+
+// SaveToWorkflowBranch commits the on-disk state of an article to its cms/<slug> branch.
+// The commit is built with a temporary index so the working tree and the
+// checked-out branch are never touched.
+func SaveToWorkflowBranch(relPath string, author *models.GitUser) error {
+	start := time.Now()
+	defer func() {
+		fmt.Printf("[Workflow] Save %s, Duration: %v\n", relPath, time.Since(start))
+	}()
+
+	branch := WorkflowBranch(relPath)
+	branchRef := "refs/heads/" + branch
+	parentRef := branchRef
+	if !refExists(branchRef) {
+		parentRef = "refs/heads/" + config.GitBranch
+	}
+
+	parent, err := runGit(nil, nil, "rev-parse", parentRef)
+	if err != nil {
+		return err
+	}
+	parent = strings.TrimSpace(parent)
+
+	files, err := workflowFiles(relPath, parent)
+	if err != nil {
+		return err
+	}
+
+	indexFile, err := os.CreateTemp("", "hugo-cms-index-*")
+	if err != nil {
+		return err
+	}
+	indexFile.Close()
+	defer os.Remove(indexFile.Name())
+	env := []string{"GIT_INDEX_FILE=" + indexFile.Name()}
+
+	if _, err := runGit(env, nil, "read-tree", parent); err != nil {
+		return err
+	}
+	modes, err := treeModes(parent, files)
+	if err != nil {
+		return err
+	}
+	trustExecBit := true
+	if out, err := runGit(nil, nil, "config", "--bool", "core.fileMode"); err == nil {
+		trustExecBit = strings.TrimSpace(out) != "false"
+	}
+	for _, file := range files {
+		fullPath := filepath.Join(config.RepoPath, filepath.FromSlash(file))
+		info, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) {
+			if _, err := runGit(env, nil, "update-index", "--force-remove", "--", file); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Like git add: symlinks store their target, and files go through
+		// the clean filters (LFS, eol) configured for their path
+		var blob string
+		mode := "100644"
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(fullPath)
+			if err != nil {
+				return err
+			}
+			mode = "120000"
+			blob, err = runGit(nil, []byte(target), "hash-object", "-w", "--stdin")
+			if err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			content, err := os.ReadFile(fullPath)
+			if err != nil {
+				return err
+			}
+			switch {
+			case !trustExecBit && modes[file] != "":
+				mode = modes[file]
+			case info.Mode()&0111 != 0:
+				mode = "100755"
+			}
+			blob, err = runGit(nil, content, "hash-object", "-w", "--path="+file, "--stdin")
+			if err != nil {
+				return err
+			}
+		default:
+			continue // A submodule or other special file keeps its entry
+		}
+		cacheInfo := mode + "," + strings.TrimSpace(blob) + "," + file
+		if _, err := runGit(env, nil, "update-index", "--add", "--cacheinfo", cacheInfo); err != nil {
+			return err
+		}
+	}
+
+	tree, err := runGit(env, nil, "write-tree")
+	if err != nil {
+		return err
+	}
+	tree = strings.TrimSpace(tree)
+
+	parentTree, _ := runGit(nil, nil, "rev-parse", parent+"^{tree}")
+	if strings.TrimSpace(parentTree) == tree {
+		return nil // Nothing changed since the last save
+	}
+
+	action := CommitUpdate
+	if _, err := os.Lstat(filepath.Join(config.RepoPath, "content", relPath)); os.IsNotExist(err) {
+		action = CommitDelete
+	} else if parentRef != branchRef && !refExists(parent+":"+filepath.ToSlash(filepath.Join("content", relPath))) {
+		action = CommitCreate
+	}
+	msg := RenderCommitMessage(action, filepath.Join("content", relPath), author)
+	commit, err := runGit(commitIdentityEnv(author), nil, "commit-tree", tree, "-p", parent, "-m", commitMessageFor(msg, author))
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(nil, nil, "update-ref", branchRef, strings.TrimSpace(commit))
+	return err
+}
+
+// treeModes returns the modes of the regular files among files on rev, for
+// repositories that don't track the executable bit (core.fileMode=false).
+func treeModes(rev string, files []string) (map[string]string, error) {
+	out, err := runGit(nil, nil, append([]string{"ls-tree", "-r", "-z", rev, "--"}, files...)...)
+	if err != nil {
+		return nil, err
+	}
+	modes := map[string]string{}
+	for _, line := range strings.Split(out, "\x00") {
+		meta, file, ok := strings.Cut(line, "\t")
+		if fields := strings.Fields(meta); ok && len(fields) == 3 && (fields[0] == "100644" || fields[0] == "100755") {
+			modes[file] = fields[0]
+		}
+	}
+	return modes, nil
+}
+
+// workingTreeMatches reports whether the working tree holds file as it is on
+// rev, or lacks it like rev does.
+func workingTreeMatches(rev, file string) (bool, error) {
+	want, revErr := runGit(nil, nil, "rev-parse", "--verify", "--quiet", rev+":"+file)
+	fullPath := filepath.Join(config.RepoPath, filepath.FromSlash(file))
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return revErr != nil, nil
+	}
+	if err != nil || revErr != nil {
+		return false, err
+	}
+
+	var got string
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return false, err
+		}
+		got, err = runGit(nil, []byte(target), "hash-object", "--stdin")
+		if err != nil {
+			return false, err
+		}
+	} else if got, err = runGit(nil, nil, "hash-object", "--path="+file, "--", fullPath); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(got) == strings.TrimSpace(want), nil
+}
+
+// workflowEntryPath finds the article a cms/* branch was created for.
+func workflowEntryPath(branch string) (string, error) {
+	out, err := runGit(nil, nil, "diff", "--name-only", config.GitBranch+"..."+branch, "--", "content")
+	if err != nil {
+		return "", err
+	}
+
+	var candidate string
+	formats := currentContentFormats()
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !formats.isContentPage(line) {
+			continue
+		}
+		if formats.isBundleIndex(line) || candidate == "" {
+			candidate = line
+		}
+	}
+	if candidate == "" {
+		return "", nil
+	}
+	return strings.TrimPrefix(candidate, "content/"), nil
+}
+
+func workflowStatusFromLabels(pr *PullRequest) string {
+	for _, label := range pr.Labels {
+		if status := strings.TrimPrefix(label.Name, workflowLabelPrefix); status != label.Name && isValidWorkflowStatus(status) {
+			return status
+		}
+	}
+	return WorkflowPendingReview
+}
+
+// ListWorkflowEntries returns all articles with a local cms/* branch, optionally filtered by status.
+func ListWorkflowEntries(token, status string) ([]models.WorkflowEntry, error) {
+	out, err := runGit(nil, nil, "for-each-ref", "--format=%(refname:short)%09%(committerdate:iso-strict)", "refs/heads/"+workflowBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repo, err := GetRemoteRepo()
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewRepoClient(token)
+	if err != nil {
+		return nil, err
+	}
+	prs, err := client.ListOpenPullRequests(owner, repo, config.GitBranch)
+	if err != nil {
+		return nil, err
+	}
+	prByBranch := make(map[string]*PullRequest, len(prs))
+	for i := range prs {
+		prByBranch[prs[i].Head.Ref] = &prs[i]
+	}
+
+	entries := []models.WorkflowEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		branch := fields[0]
+		relPath, err := workflowEntryPath(branch)
+		if err != nil || relPath == "" {
+			continue // Already merged or unrelated to content
+		}
+
+		entry := models.WorkflowEntry{
+			Slug:   strings.TrimPrefix(branch, workflowBranchPrefix),
+			Branch: branch,
+			Path:   relPath,
+			Title:  relPath,
+			Status: WorkflowDraft,
+		}
+		entry.UpdatedAt, _ = time.Parse(time.RFC3339, fields[1])
+
+		if content, err := runGit(nil, nil, "show", branch+":content/"+relPath); err == nil {
+			if fm, _, _, err := ParseFrontMatter([]byte(content)); err == nil {
+				if t, ok := fm["title"].(string); ok {
+					entry.Title = t
+				}
+			}
+		}
+
+		if pr, ok := prByBranch[branch]; ok {
+			entry.PRNumber = pr.Number
+			entry.PRURL = pr.HTMLURL
+			entry.Status = workflowStatusFromLabels(pr)
+		}
+
+		if status != "" && entry.Status != status {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func findWorkflowEntry(token, relPath string) (*models.WorkflowEntry, error) {
+	entries, err := ListWorkflowEntries(token, "")
+	if err != nil {
+		return nil, err
+	}
+	branch := WorkflowBranch(relPath)
+	for i := range entries {
+		if entries[i].Branch == branch {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no workflow entry for %s", relPath)
+}
+
+func pushWorkflowBranch(token, branch string) (string, error) {
+	return ExecuteGitWithToken(config.RepoPath, token, "push", config.GitRemote, "refs/heads/"+branch+":refs/heads/"+branch)
+}
+
+// PublishWorkflowEntry pushes the entry branch and opens a pull request for review.
+func PublishWorkflowEntry(token, relPath string) (*models.WorkflowEntry, string, error) {
+	entry, err := findWorkflowEntry(token, relPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	log, err := pushWorkflowBranch(token, entry.Branch)
+	if err != nil {
+		return nil, log, err
+	}
+
+	if entry.PRNumber != 0 {
+		return entry, log, nil // Already in review, the push updated it
+	}
+
+	owner, repo, err := GetRemoteRepo()
+	if err != nil {
+		return nil, log, err
+	}
+	client, err := NewRepoClient(token)
+	if err != nil {
+		return nil, log, err
+	}
+	title := fmt.Sprintf("Update %s via HomeCMS", entry.Title)
+	body := fmt.Sprintf("Automatically generated by HomeCMS for `content/%s`.", entry.Path)
+	pr, err := client.CreatePullRequest(owner, repo, entry.Branch, config.GitBranch, title, body)
+	if err != nil {
+		return nil, log, err
+	}
+	if err := client.SetLabels(owner, repo, pr.Number, []string{workflowLabelPrefix + WorkflowPendingReview}); err != nil {
+		return nil, log, err
+	}
+
+	entry.PRNumber = pr.Number
+	entry.PRURL = pr.HTMLURL
+	entry.Status = WorkflowPendingReview
+	return entry, log, nil
+}
+
+// UpdateWorkflowStatus moves an entry with an open pull request between statuses.
+func UpdateWorkflowStatus(token, relPath, status string) (*models.WorkflowEntry, error) {
+	if !isValidWorkflowStatus(status) {
+		return nil, fmt.Errorf("invalid status: %s", status)
+	}
+	entry, err := findWorkflowEntry(token, relPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry.PRNumber == 0 {
+		return nil, fmt.Errorf("entry %s has not been published for review", entry.Slug)
+	}
+
+	owner, repo, err := GetRemoteRepo()
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewRepoClient(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SetLabels(owner, repo, entry.PRNumber, []string{workflowLabelPrefix + status}); err != nil {
+		return nil, err
+	}
+	entry.Status = status
+	return entry, nil
+}
+
+// MergeWorkflowEntry merges a ready entry into config.GitBranch and syncs the working tree.
+func MergeWorkflowEntry(token string, author *models.GitUser, relPath string) (string, error) {
+	entry, err := findWorkflowEntry(token, relPath)
+	if err != nil {
+		return "", err
+	}
+	if entry.Status != WorkflowPendingPublish {
+		return "", fmt.Errorf("entry %s is not ready to publish (status: %s)", entry.Slug, entry.Status)
+	}
+
+	// The working tree still holds the saved (uncommitted) article, which
+	// would block the pull. It is reset once merged, so it must not hold
+	// edits that never reached the branch (e.g. a failed branch update).
+	changed, err := runGit(nil, nil, "diff", "--name-only", "-z", config.GitBranch+"..."+entry.Branch)
+	if err != nil {
+		return "", err
+	}
+	var files []string
+	for _, file := range strings.Split(changed, "\x00") {
+		if file == "" {
+			continue
+		}
+		same, err := workingTreeMatches(entry.Branch, file)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return "", fmt.Errorf("%s has changes that are not on %s; save the article again before publishing", file, entry.Branch)
+		}
+		files = append(files, file)
+	}
+
+	pushLog, err := pushWorkflowBranch(token, entry.Branch)
+	if err != nil {
+		return pushLog, err
+	}
+
+	owner, repo, err := GetRemoteRepo()
+	if err != nil {
+		return pushLog, err
+	}
+	client, err := NewRepoClient(token)
+	if err != nil {
+		return pushLog, err
+	}
+	title := fmt.Sprintf("Merge %s via HomeCMS", entry.Title)
+	if err := client.MergePullRequest(owner, repo, entry.PRNumber, title); err != nil {
+		return pushLog, err
+	}
+
+	// The saved files now live on the merged branch
+	for _, file := range files {
+		if refExists("HEAD:" + file) {
+			if _, err := runGit(nil, nil, "checkout", "HEAD", "--", file); err != nil {
+				return pushLog, err
+			}
+		} else if err := os.Remove(filepath.Join(config.RepoPath, filepath.FromSlash(file))); err != nil && !os.IsNotExist(err) {
+			return pushLog, err
+		}
+	}
+
+	syncLog, err := SyncRepo(token, author)
+	log := fmt.Sprintf("--- Git Push ---\n%s\n\n--- Merge ---\nMerged #%d\n\n--- Git Pull ---\n%s", pushLog, entry.PRNumber, syncLog)
+	if err != nil {
+		return log, err
+	}
+
+	if err := client.DeleteBranch(owner, repo, entry.Branch); err != nil {
+		fmt.Printf("[Workflow] Warning: failed to delete remote branch %s: %v\n", entry.Branch, err)
+	}
+	if _, err := runGit(nil, nil, "branch", "-D", entry.Branch); err != nil {
+		fmt.Printf("[Workflow] Warning: failed to delete local branch %s: %v\n", entry.Branch, err)
+	}
+	return log, nil
+}
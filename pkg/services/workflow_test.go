@@ -0,0 +1,442 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"hugo-cms/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRepo is a working tree cloned from a local bare repository whose
+// path ends in acme/site.git, so it resolves as the GitHub repo acme/site.
+type testRepo struct {
+	origin string
+	work   string
+}
+
+func newTestRepo(t *testing.T, files map[string]string) *testRepo {
+	t.Helper()
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(key, "Test")
+	}
+	for _, key := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(key, "test@example.com")
+	}
+	root := t.TempDir()
+	r := &testRepo{origin: filepath.Join(root, "acme", "site.git"), work: filepath.Join(root, "work")}
+	gitIn(t, root, "init", "--quiet", "--bare", "-b", "main", r.origin)
+	gitIn(t, root, "clone", "--quiet", r.origin, r.work)
+	for name, content := range files {
+		r.write(t, name, content)
+	}
+	gitIn(t, r.work, "add", ".")
+	gitIn(t, r.work, "commit", "--quiet", "-m", "init")
+	gitIn(t, r.work, "push", "--quiet", "origin", "HEAD:main")
+
+	saved := []string{config.RepoPath, config.GitBranch, config.GitRemote, config.GitBackend, config.GitAuthMode}
+	t.Cleanup(func() {
+		config.RepoPath, config.GitBranch, config.GitRemote, config.GitBackend, config.GitAuthMode = saved[0], saved[1], saved[2], saved[3], saved[4]
+		InvalidateCache()
+	})
+	config.RepoPath, config.GitBranch, config.GitRemote, config.GitBackend, config.GitAuthMode = r.work, "main", "origin", "exec", AuthOAuth
+	return r
+}
+
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (r *testRepo) write(t *testing.T, name, content string) {
+	t.Helper()
+	full := filepath.Join(r.work, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tree lists the files below dir on rev of the bare repository.
+func (r *testRepo) tree(t *testing.T, rev, dir string) []string {
+	t.Helper()
+	out := gitIn(t, r.origin, "ls-tree", "-r", "--name-only", rev, "--", dir+"/")
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func (r *testRepo) show(t *testing.T, dir, object string) string {
+	t.Helper()
+	return gitIn(t, dir, "show", object)
+}
+
+const bundleIndex = "---\ntitle: Trip\n---\nDay one.\n"
+
+func bundleRepo(t *testing.T) *testRepo {
+	return newTestRepo(t, map[string]string{
+		".gitignore":                    "*.tmp\n",
+		"content/posts/trip/index.md":   bundleIndex,
+		"content/posts/trip/old.jpg":    "old",
+		"content/posts/trip/keep.jpg":   "keep",
+		"content/posts/other.md":        "---\ntitle: Other\n---\n",
+		"content/posts/trip-notes.md":   "---\ntitle: Notes\n---\n",
+		"content/posts/single/index.md": "---\ntitle: Single\n---\n",
+	})
+}
+
+func TestWorkflowFiles(t *testing.T) {
+	r := bundleRepo(t)
+	r.write(t, "content/posts/trip/index.md", bundleIndex+"Day two.\n")
+	r.write(t, "content/posts/trip/new.jpg", "new")
+	r.write(t, "content/posts/trip/scratch.tmp", "ignored")
+	r.write(t, "content/posts/trip-notes.md", "---\ntitle: Notes\n---\nchanged\n")
+	os.Remove(filepath.Join(r.work, "content/posts/trip/old.jpg"))
+	head := gitIn(t, r.work, "rev-parse", "HEAD")
+
+	tests := []struct {
+		name    string
+		relPath string
+		want    []string
+	}{
+		{"bundle", "posts/trip/index.md", []string{
+			"content/posts/trip/index.md",
+			"content/posts/trip/keep.jpg",
+			"content/posts/trip/new.jpg",
+			"content/posts/trip/old.jpg",
+		}},
+		{"single file", "posts/other.md", []string{"content/posts/other.md"}},
+		{"unchanged bundle", "posts/single/index.md", []string{"content/posts/single/index.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := workflowFiles(tt.relPath, head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("workflowFiles(%q) = %v, want %v", tt.relPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowSlug(t *testing.T) {
+	tests := []struct {
+		relPath string
+		want    string
+	}{
+		{"posts/hello.md", "posts/hello"},
+		{"posts/trip/index.md", "posts/trip"},
+		{"posts/_index.md", "posts/_index"},
+		{"docs/guides/_index.md", "docs/guides-_index"},
+		{"posts/2024/trip/index.md", "posts/2024-trip"},
+		{"about.md", "_root/about"},
+		{"_index.md", "_root/_index"},
+		{"posts/Hello World!.md", "posts/Hello-World"},
+		{"posts/a..b.lock.md", "posts/a.b"},
+		{".hidden/-x-.md", "hidden/x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relPath, func(t *testing.T) {
+			if got := WorkflowSlug(tt.relPath); got != tt.want {
+				t.Errorf("WorkflowSlug(%q) = %q, want %q", tt.relPath, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no safe characters", func(t *testing.T) {
+		a, b := WorkflowSlug("posts/日本.md"), WorkflowSlug("posts/中文.md")
+		if !strings.HasPrefix(a, "posts/") || len(a) != len("posts/")+12 || a == b {
+			t.Errorf("slugs %q and %q, want distinct hashed names", a, b)
+		}
+	})
+}
+
+// A section page and the articles of its section, the home page included,
+// each get a branch.
+func TestSaveToWorkflowBranchSectionAndArticle(t *testing.T) {
+	r := newTestRepo(t, map[string]string{
+		"content/_index.md":       "---\ntitle: Home\n---\n",
+		"content/posts/_index.md": "---\ntitle: Posts\n---\n",
+		"content/posts/foo.md":    "---\ntitle: Foo\n---\n",
+	})
+	for _, article := range []string{"_index.md", "posts/_index.md", "posts/foo.md"} {
+		r.write(t, "content/"+article, "---\ntitle: Edited\n---\n")
+		if err := SaveToWorkflowBranch(article, nil); err != nil {
+			t.Fatalf("save %s: %v", article, err)
+		}
+		branch := WorkflowBranch(article)
+		if got := r.show(t, r.work, branch+":content/"+article); got != "---\ntitle: Edited\n---" {
+			t.Errorf("%s on %s = %q", article, branch, got)
+		}
+	}
+}
+
+func TestSaveToWorkflowBranchDelete(t *testing.T) {
+	r := newTestRepo(t, map[string]string{
+		"content/posts/foo.md": "---\ntitle: Foo\n---\n",
+		"content/posts/bar.md": "---\ntitle: Bar\n---\n",
+	})
+	os.Remove(filepath.Join(r.work, "content/posts/foo.md"))
+	if err := SaveToWorkflowBranch("posts/foo.md", nil); err != nil {
+		t.Fatal(err)
+	}
+	branch := WorkflowBranch("posts/foo.md")
+	gitIn(t, r.work, "push", "--quiet", "origin", branch)
+	if got, want := r.tree(t, branch, "content/posts"), []string{"content/posts/bar.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("branch files = %v, want %v", got, want)
+	}
+	if msg := gitIn(t, r.work, "log", "-1", "--format=%s", branch); !strings.Contains(msg, "Delete") {
+		t.Errorf("commit message = %q, want a delete", msg)
+	}
+}
+
+func TestSaveToWorkflowBranchBundle(t *testing.T) {
+	r := bundleRepo(t)
+	r.write(t, "content/posts/trip/index.md", bundleIndex+"Day two.\n")
+	r.write(t, "content/posts/trip/new.jpg", "new")
+	r.write(t, "content/posts/trip/scratch.tmp", "ignored")
+	os.Remove(filepath.Join(r.work, "content/posts/trip/old.jpg"))
+
+	if err := SaveToWorkflowBranch("posts/trip/index.md", nil); err != nil {
+		t.Fatal(err)
+	}
+	branch := WorkflowBranch("posts/trip/index.md")
+	gitIn(t, r.work, "push", "--quiet", "origin", branch)
+
+	want := []string{"content/posts/trip/index.md", "content/posts/trip/keep.jpg", "content/posts/trip/new.jpg"}
+	if got := r.tree(t, branch, "content/posts/trip"); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch files = %v, want %v", got, want)
+	}
+	if got := r.show(t, r.work, branch+":content/posts/trip/index.md"); !strings.Contains(got, "Day two.") {
+		t.Errorf("branch index.md = %q, want the saved edit", got)
+	}
+	if status := gitIn(t, r.work, "status", "--porcelain"); !strings.Contains(status, " D content/posts/trip/old.jpg") {
+		t.Errorf("working tree was changed:\n%s", status)
+	}
+
+	// Reverting an edit and restoring the deleted file carries over to the branch
+	r.write(t, "content/posts/trip/index.md", bundleIndex)
+	r.write(t, "content/posts/trip/old.jpg", "old")
+	if err := SaveToWorkflowBranch("posts/trip/index.md", nil); err != nil {
+		t.Fatal(err)
+	}
+	gitIn(t, r.work, "push", "--quiet", "--force", "origin", branch)
+	want = []string{"content/posts/trip/index.md", "content/posts/trip/keep.jpg", "content/posts/trip/new.jpg", "content/posts/trip/old.jpg"}
+	if got := r.tree(t, branch, "content/posts/trip"); !reflect.DeepEqual(got, want) {
+		t.Errorf("branch files after revert = %v, want %v", got, want)
+	}
+	if got := r.show(t, r.work, branch+":content/posts/trip/index.md"); got != strings.TrimSpace(bundleIndex) {
+		t.Errorf("branch index.md after revert = %q, want the original", got)
+	}
+}
+
+// stubGitHub serves the pull request endpoints of the workflow for acme/site.
+// Merging a pull request merges its branch in the bare repository.
+// Saved files keep their executable bit and symlinks, and go through the
+// clean filters of their path like git add.
+func TestSaveToWorkflowBranchModes(t *testing.T) {
+	r := newTestRepo(t, map[string]string{
+		".gitattributes":              "*.md text\n",
+		"content/posts/trip/index.md": bundleIndex,
+		"content/posts/trip/run.sh":   "#!/bin/sh\n",
+	})
+	if err := os.Chmod(filepath.Join(r.work, "content/posts/trip/run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("index.md", filepath.Join(r.work, "content/posts/trip/alias.md")); err != nil {
+		t.Fatal(err)
+	}
+	r.write(t, "content/posts/trip/index.md", "---\r\ntitle: Trip\r\n---\r\n")
+
+	if err := SaveToWorkflowBranch("posts/trip/index.md", nil); err != nil {
+		t.Fatal(err)
+	}
+	branch := WorkflowBranch("posts/trip/index.md")
+	want := map[string]string{
+		"content/posts/trip/alias.md": "120000",
+		"content/posts/trip/index.md": "100644",
+		"content/posts/trip/run.sh":   "100755",
+	}
+	for _, line := range strings.Split(gitIn(t, r.work, "ls-tree", "-r", branch, "--", "content/posts/trip/"), "\n") {
+		meta, file, _ := strings.Cut(line, "\t")
+		if mode := strings.Fields(meta)[0]; mode != want[file] {
+			t.Errorf("%s has mode %s, want %s", file, mode, want[file])
+		}
+	}
+	if got := r.show(t, r.work, branch+":content/posts/trip/index.md"); got != "---\ntitle: Trip\n---" {
+		t.Errorf("index.md = %q, want LF line endings", got)
+	}
+}
+
+type stubGitHub struct {
+	mu     sync.Mutex
+	t      *testing.T
+	repo   *testRepo
+	prs    []PullRequest
+	labels map[int][]string
+	merged []int
+}
+
+func newStubGitHub(t *testing.T, repo *testRepo) *stubGitHub {
+	stub := &stubGitHub{t: t, repo: repo, labels: map[int][]string{}}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	apiURL := config.GitHubAPIURL
+	t.Cleanup(func() { config.GitHubAPIURL = apiURL })
+	config.GitHubAPIURL = server.URL
+	return stub
+}
+
+func (s *stubGitHub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var number int
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/repos/acme/site/pulls":
+		prs := []PullRequest{}
+		for _, pr := range s.prs {
+			if pr.State == "open" {
+				for _, label := range s.labels[pr.Number] {
+					pr.Labels = append(pr.Labels, struct {
+						Name string `json:"name"`
+					}{label})
+				}
+				prs = append(prs, pr)
+			}
+		}
+		json.NewEncoder(w).Encode(prs)
+	case req.Method == http.MethodPost && req.URL.Path == "/repos/acme/site/pulls":
+		var body struct{ Head, Base string }
+		json.NewDecoder(req.Body).Decode(&body)
+		pr := PullRequest{Number: len(s.prs) + 1, State: "open"}
+		pr.HTMLURL = fmt.Sprintf("https://github.com/acme/site/pull/%d", pr.Number)
+		pr.Head.Ref = body.Head
+		s.prs = append(s.prs, pr)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(pr)
+	case req.Method == http.MethodPut && scan(req.URL.Path, "/repos/acme/site/issues/%d/labels", &number):
+		var body struct{ Labels []string }
+		json.NewDecoder(req.Body).Decode(&body)
+		s.labels[number] = body.Labels
+		w.Write([]byte("[]"))
+	case req.Method == http.MethodPut && scan(req.URL.Path, "/repos/acme/site/pulls/%d/merge", &number):
+		pr := &s.prs[number-1]
+		clone := filepath.Join(s.t.TempDir(), "merge")
+		gitIn(s.t, s.repo.origin, "clone", "--quiet", s.repo.origin, clone)
+		gitIn(s.t, clone, "merge", "--quiet", "--no-ff", "-m", "Merge pull request", "origin/"+pr.Head.Ref)
+		gitIn(s.t, clone, "push", "--quiet", "origin", "HEAD:main")
+		pr.State = "closed"
+		s.merged = append(s.merged, number)
+		w.Write([]byte(`{"merged":true}`))
+	case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/repos/acme/site/git/refs/heads/"):
+		gitIn(s.t, s.repo.origin, "update-ref", "-d", strings.TrimPrefix(req.URL.Path, "/repos/acme/site/git/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+}
+
+func scan(path, format string, number *int) bool {
+	n, err := fmt.Sscanf(path, format, number)
+	return err == nil && n == 1 && fmt.Sprintf(format, *number) == path
+}
+
+func TestWorkflowPublishAndMerge(t *testing.T) {
+	r := bundleRepo(t)
+	stub := newStubGitHub(t, r)
+	const article = "posts/trip/index.md"
+
+	r.write(t, "content/posts/trip/index.md", bundleIndex+"Day two.\n")
+	r.write(t, "content/posts/trip/new.jpg", "new")
+	os.Remove(filepath.Join(r.work, "content/posts/trip/old.jpg"))
+	if err := SaveToWorkflowBranch(article, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ListWorkflowEntries("token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != article || entries[0].Status != WorkflowDraft || entries[0].Title != "Trip" {
+		t.Fatalf("entries = %+v, want one draft of %s", entries, article)
+	}
+
+	entry, log, err := PublishWorkflowEntry("token", article)
+	if err != nil {
+		t.Fatalf("publish: %v\n%s", err, log)
+	}
+	if entry.PRNumber != 1 || entry.Status != WorkflowPendingReview {
+		t.Errorf("published entry = %+v, want PR #1 pending review", entry)
+	}
+	if got := r.tree(t, entry.Branch, "content/posts/trip"); len(got) != 3 {
+		t.Errorf("pushed branch files = %v", got)
+	}
+
+	if _, err := MergeWorkflowEntry("token", nil, article); err == nil {
+		t.Error("merging an entry pending review succeeded")
+	}
+	if entry, err = UpdateWorkflowStatus("token", article, WorkflowPendingPublish); err != nil {
+		t.Fatal(err)
+	}
+	if got := stub.labels[1]; !reflect.DeepEqual(got, []string{"decap-cms/pending_publish"}) {
+		t.Errorf("labels = %v", got)
+	}
+
+	// An edit that never reached the branch must survive a refused merge
+	unsaved := bundleIndex + "Day two.\nDay three.\n"
+	r.write(t, "content/posts/trip/index.md", unsaved)
+	if _, err := MergeWorkflowEntry("token", nil, article); err == nil || !strings.Contains(err.Error(), "not on "+entry.Branch) {
+		t.Errorf("merging with unsaved changes: %v, want refusal", err)
+	}
+	if len(stub.merged) != 0 {
+		t.Errorf("merged PRs = %v before the edit was saved", stub.merged)
+	}
+	if got, _ := os.ReadFile(filepath.Join(r.work, "content/posts/trip/index.md")); string(got) != unsaved {
+		t.Errorf("unsaved edit lost: %q", got)
+	}
+	if err := SaveToWorkflowBranch(article, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if log, err := MergeWorkflowEntry("token", nil, article); err != nil {
+		t.Fatalf("merge: %v\n%s", err, log)
+	}
+	if !reflect.DeepEqual(stub.merged, []int{1}) {
+		t.Errorf("merged PRs = %v, want [1]", stub.merged)
+	}
+	want := []string{"content/posts/trip/index.md", "content/posts/trip/keep.jpg", "content/posts/trip/new.jpg"}
+	if got := r.tree(t, "main", "content/posts/trip"); !reflect.DeepEqual(got, want) {
+		t.Errorf("main files = %v, want %v", got, want)
+	}
+	if head, remote := gitIn(t, r.work, "rev-parse", "HEAD"), gitIn(t, r.origin, "rev-parse", "main"); head != remote {
+		t.Errorf("working tree at %s, remote main at %s", head, remote)
+	}
+	if status := gitIn(t, r.work, "status", "--porcelain"); status != "" {
+		t.Errorf("working tree not clean after merge:\n%s", status)
+	}
+	if branches := gitIn(t, r.work, "branch", "--list", "cms/*"); branches != "" {
+		t.Errorf("local workflow branches left: %s", branches)
+	}
+	if branches := gitIn(t, r.origin, "branch", "--list", "cms/*"); branches != "" {
+		t.Errorf("remote workflow branches left: %s", branches)
+	}
+}
@@ -4,12 +4,22 @@ export async function fetchConfig() {
     return await res.json();
 }
 
-export async function fetchArticles() {
-    const res = await fetch('/api/articles');
+// params: collection, q, draft, dirty, tag, date_from, date_to, sort,
+// limit and cursor (see ListArticles); empty values are left out.
+export async function fetchArticles(params = {}) {
+    const query = new URLSearchParams(Object.entries(params).filter(([, v]) => v !== '' && v != null));
+    const res = await fetch('/api/articles' + (query.toString() ? '?' + query : ''));
     if (res.status === 401) {
         window.location.href = "/login";
         return null;
     }
+    if (!res.ok) throw new Error("Failed to fetch articles");
+    return await res.json();
+}
+
+export async function searchArticles(query, limit = 20) {
+    const res = await fetch(`/api/search?q=${encodeURIComponent(query)}&limit=${limit}`);
+    if (!res.ok) throw new Error("Search failed");
     return await res.json();
 }
 
@@ -76,21 +86,46 @@ export async function runBuild() {
     return await res.json();
 }
 
+export async function fetchBuild(id) {
+    const res = await fetch(`/api/builds/${encodeURIComponent(id)}`);
+    if (!res.ok) throw new Error("Failed to fetch build");
+    return await res.json();
+}
+
 export async function runSync() {
     const res = await fetch('/api/sync', { method: 'POST' });
     return await res.json();
 }
 
-export async function runPublish(path = null) {
+export async function runPublish(path = null, message = '', paths = []) {
     const options = { method: 'POST' };
-    if (path) {
+    if (path || message || paths.length) {
         options.headers = { 'Content-Type': 'application/json' };
-        options.body = JSON.stringify({ path });
+        options.body = JSON.stringify({ path: path || '', paths, message });
     }
     const res = await fetch('/api/publish', options);
     return await res.json();
 }
 
+export async function fetchChanges() {
+    const res = await fetch('/api/changes');
+    if (!res.ok) throw new Error("Failed to fetch changes");
+    return await res.json();
+}
+
+export async function discardChanges(payload) {
+    const res = await fetch('/api/discard', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify(payload)
+    });
+    if (!res.ok) {
+        const data = await res.json();
+        throw new Error(data.error || "Discard failed");
+    }
+    return await res.json();
+}
+
 export async function fetchMedia(mode, path) {
     let url = `/api/media?mode=${mode}`;
     if (path) url += `&path=${encodeURIComponent(path)}`;
@@ -120,4 +155,155 @@ export async function deleteMedia(repoPath) {
     });
     if (!res.ok) throw new Error("Delete failed");
     return await res.json();
-}
\ No newline at end of file
+}
+export async function fetchWorkflowEntries(status = '') {
+    let url = '/api/workflow/entries';
+    if (status) url += `?status=${encodeURIComponent(status)}`;
+    const res = await fetch(url);
+    if (!res.ok) throw new Error("Failed to fetch workflow entries");
+    return await res.json();
+}
+
+export async function publishWorkflowEntry(path) {
+    const res = await fetch('/api/workflow/publish', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({ path })
+    });
+    return await res.json();
+}
+
+export async function updateWorkflowStatus(path, status) {
+    const res = await fetch('/api/workflow/status', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({ path, status })
+    });
+    return await res.json();
+}
+
+export async function mergeWorkflowEntry(path) {
+    const res = await fetch('/api/workflow/merge', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({ path })
+    });
+    return await res.json();
+}
+
+export async function fetchHistory(path) {
+    const res = await fetch(`/api/article/history?path=${encodeURIComponent(path)}`);
+    if (!res.ok) throw new Error("Failed to load history");
+    return await res.json();
+}
+
+export async function fetchRevision(path, sha) {
+    const res = await fetch(`/api/article/revision?path=${encodeURIComponent(path)}&sha=${encodeURIComponent(sha)}`);
+    if (!res.ok) throw new Error("Failed to load revision");
+    return await res.json();
+}
+
+export async function restoreRevision(path, sha) {
+    const res = await fetch('/api/article/restore', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({ path, sha })
+    });
+    if (!res.ok) {
+        const data = await res.json();
+        throw new Error(data.error || "Restore failed");
+    }
+    return await res.json();
+}
+
+export async function fetchConflicts() {
+    const res = await fetch('/api/conflicts');
+    if (!res.ok) throw new Error("Failed to load conflicts");
+    return await res.json();
+}
+
+export async function resolveConflict(payload) {
+    const res = await fetch('/api/conflicts/resolve', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify(payload)
+    });
+    if (!res.ok) {
+        const data = await res.json();
+        throw new Error(data.error || "Resolve failed");
+    }
+    return await res.json();
+}
+
+export async function abortMerge() {
+    const res = await fetch('/api/conflicts/abort', { method: 'POST' });
+    return await res.json();
+}
+
+export async function fetchPreviewUrl(path) {
+    const res = await fetch(`/api/article/preview-url?path=${encodeURIComponent(path)}`);
+    if (!res.ok) throw new Error("Failed to resolve preview URL");
+    return await res.json();
+}
+
+export async function fetchPreviewStatus() {
+    const res = await fetch('/api/preview/status');
+    if (!res.ok) throw new Error("Failed to fetch preview status");
+    return await res.json();
+}
+
+export async function fetchDraftPreviewStatus() {
+    const res = await fetch('/api/preview/draft');
+    if (!res.ok) throw new Error("Failed to fetch draft preview status");
+    return await res.json();
+}
+
+export async function updateDraftPreview(payload) {
+    const res = await fetch('/api/preview/draft', {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify(payload)
+    });
+    const data = await res.json();
+    if (!res.ok) throw new Error(data.error || "Draft preview failed");
+    return data;
+}
+
+export async function restartPreview() {
+    const res = await fetch('/api/preview/restart', { method: 'POST' });
+    return await res.json();
+}
+
+// Streams hugo server/build output; handlers maps event types
+// (log, error, warn, build_start, build_done) to callbacks.
+// EventSource reconnects on its own after network errors.
+export function subscribeHugoEvents(handlers) {
+    const source = new EventSource('/api/events/hugo');
+    for (const [type, handler] of Object.entries(handlers)) {
+        source.addEventListener(type, (e) => handler(JSON.parse(e.data)));
+    }
+    return source;
+}
+
+export function subscribeFileEvents(onChange) {
+    const source = new EventSource('/api/events/files');
+    source.addEventListener('change', (e) => onChange(JSON.parse(e.data)));
+    return source;
+}
+
+export async function fetchRemoteStatus(fetchRemote = false) {
+    const res = await fetch('/api/git/remote' + (fetchRemote ? '?fetch=1' : ''));
+    if (!res.ok) throw new Error("Failed to fetch remote status");
+    return await res.json();
+}
+
+export async function pushPending() {
+    const res = await fetch('/api/git/push', { method: 'POST' });
+    return await res.json();
+}
+
+export async function fetchGitStatus() {
+    const res = await fetch('/api/git/status');
+    if (!res.ok) throw new Error("Failed to fetch git status");
+    return await res.json();
+}
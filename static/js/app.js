@@ -4,6 +4,8 @@ import * as Editor from './editor.js';
 
 // Global State
 let cmsConfig = null;
+// In the editorial workflow articles go out through pull requests
+const editorialWorkflow = document.body.dataset.publishMode === 'editorial_workflow';
 
 // Initialization
 init();
@@ -18,7 +20,10 @@ async function init() {
     }
 
     await refreshFileList();
+    initFileFilter();
     Editor.initAutoSave();
+    watchHugoEvents();
+    watchFileEvents();
 
     // --- Expose functions to Global Scope for HTML onclick handlers ---
 
@@ -31,9 +36,7 @@ async function init() {
 
     // Editor
     window.loadFile = Editor.loadFile;
-    window.buildAndPreview = async () => {
-        await Editor.execAutoSave();
-    };
+    window.buildAndPreview = Editor.previewDraft;
     window.saveFile = async () => {
         await Editor.saveFile();
         await refreshFileList();
@@ -58,6 +61,7 @@ async function init() {
             Editor.insertText(markdown);
         }, collectionName, currentPath);
     };
+    window.showSearch = () => UI.showSearchModal(API.searchArticles, Editor.loadFile);
     window.resetChanges = Editor.resetChanges;
     window.showDiff = Editor.showDiff;
 
@@ -65,25 +69,123 @@ async function init() {
     window.runSync = runSync;
     window.runPublish = runPublish;
     window.publishFile = publishFile;
+    window.pushPending = pushPending;
+    window.runBuild = runBuild;
 
     console.log("Hugo CMS Initialized");
 }
 
 async function refreshFileList() {
     try {
-        const files = await API.fetchArticles();
+        const files = await API.fetchArticles({
+            q: document.getElementById('file-filter')?.value.trim(),
+            sort: document.getElementById('file-sort')?.value,
+        });
         if (files) {
             UI.renderFileList(files, cmsConfig);
         }
+        await refreshRemoteStatus();
     } catch (e) {
         UI.showToast("Failed to fetch file list", "error");
     }
 }
 
+function initFileFilter() {
+    let timer = null;
+    document.getElementById('file-filter')?.addEventListener('input', () => {
+        clearTimeout(timer);
+        timer = setTimeout(refreshFileList, 300);
+    });
+    document.getElementById('file-sort')?.addEventListener('change', refreshFileList);
+}
+
+async function refreshRemoteStatus() {
+    const btn = document.getElementById('push-pending-btn');
+    if (!btn) return;
+    try {
+        const status = await API.fetchRemoteStatus();
+        btn.style.display = status.ahead > 0 || status.behind > 0 ? 'block' : 'none';
+        if (status.ahead > 0) {
+            btn.textContent = `⬆ Push ${status.ahead} pending commit(s)` + (status.behind > 0 ? ` / ${status.behind} behind` : '');
+            btn.onclick = pushPending;
+        } else {
+            // Background sync found remote changes it could not fast-forward
+            btn.textContent = `⬇ ${status.behind} new commit(s) on remote — Sync`;
+            btn.onclick = runSync;
+        }
+    } catch (e) {
+        btn.style.display = 'none';
+    }
+}
+
+function watchHugoEvents() {
+    const onIssue = (issue) => {
+        UI.addHugoIssue(issue);
+        if (issue.type === 'error' && issue.path && issue.path === Editor.getCurrentPath()) {
+            const where = issue.line ? ` (line ${issue.line})` : '';
+            UI.showToast(`Hugo error in this article${where}: ${issue.message}`, "error");
+        }
+    };
+    API.subscribeHugoEvents({
+        build_start: (ev) => UI.clearHugoIssues(ev.source),
+        error: onIssue,
+        warn: onIssue,
+    });
+}
+
+// Keeps the file list in step with changes made outside the editor (git pull,
+// hugo new, ...) and reloads the open article if it changed underneath.
+function watchFileEvents() {
+    let refreshTimer = null;
+    API.subscribeFileEvents((change) => {
+        const paths = [...(change.changed || []), ...(change.removed || [])];
+        if (paths.some((p) => p.startsWith('content/'))) {
+            // Coalesce bursts into one request
+            clearTimeout(refreshTimer);
+            refreshTimer = setTimeout(refreshFileList, 300);
+        }
+
+        const current = Editor.getCurrentPath();
+        if (!current || Editor.savedRecently()) return;
+        const open = 'content/' + current;
+        if ((change.removed || []).includes(open)) {
+            UI.showToast("This article was deleted on disk. Save to keep your version.", "warning");
+        } else if ((change.changed || []).includes(open)) {
+            if (Editor.hasUnsavedChanges()) {
+                UI.showToast("This article changed on disk. Saving will overwrite those changes.", "warning");
+            } else {
+                Editor.loadFile(current);
+                UI.showToast("Reloaded: the article changed on disk", "info");
+            }
+        }
+    });
+}
+
+async function pushPending() {
+    const btn = document.getElementById('push-pending-btn');
+    if (btn) btn.disabled = true;
+    try {
+        const data = await API.pushPending();
+        if (data.status === 'ok') {
+            UI.showToast("Pushed pending commits", "success");
+        } else {
+            const detail = data.conflicts && data.conflicts.length
+                ? "Conflicts: " + data.conflicts.join(", ")
+                : data.log;
+            UI.showToast("Push Error: " + detail, "error");
+        }
+        await refreshFileList();
+    } catch (e) {
+        UI.showToast("Network Error", "error");
+    } finally {
+        if (btn) btn.disabled = false;
+    }
+}
+
 async function switchView(viewName) {
-    // Trigger save to ensure preview is up to date
+    // Render unsaved changes so the preview is up to date
     if (viewName === 'preview') {
-        await Editor.execAutoSave();
+        await Editor.previewDraft();
     }
     UI.switchView(viewName);
 }
@@ -100,6 +202,9 @@ async function runSync() {
         if (data.status === 'ok') {
             UI.showToast("Sync Complete", "success");
             await refreshFileList();
+        } else if (data.status === 'conflict') {
+            UI.showToast("Sync stopped on conflicts", "warning");
+            await showConflicts();
         } else {
             UI.showToast("Sync Error: " + data.log, "error");
         }
@@ -110,13 +215,94 @@ async function runSync() {
     }
 }
 
-async function runPublish(path = null) {
+async function runBuild() {
+    if (!confirm("現在のリポジトリの内容で本番ビルドを作成し、デプロイしますか？")) return;
+
+    const btn = document.querySelector('button[onclick="runBuild()"]');
+    const originalText = btn ? btn.textContent : "Build";
+    if (btn) {
+        btn.textContent = "Building...";
+        btn.disabled = true;
+    }
+
+    try {
+        let job = await API.runBuild();
+        // Output is streamed over /api/events/hugo; here we only wait for the result
+        while (job.status === 'queued' || job.status === 'running') {
+            await new Promise(resolve => setTimeout(resolve, 2000));
+            job = await API.fetchBuild(job.id);
+        }
+        if (job.status === 'succeeded') {
+            UI.showToast(`Build ${job.id} finished in ${job.duration}` + (job.deploy ? " and deployed" : ""), "success");
+        } else {
+            UI.showToast(`Build ${job.id} failed: ${job.error}`, "error");
+        }
+    } catch (e) {
+        UI.showToast("Build Error: " + e.message, "error");
+    } finally {
+        if (btn) {
+            btn.textContent = originalText;
+            btn.disabled = false;
+        }
+    }
+}
+
+async function showConflicts() {
+    const data = await API.fetchConflicts();
+    if (!data.merging) {
+        UI.closeModal();
+        return;
+    }
+    UI.showConflictModal(data.conflicts, async (payload) => {
+        try {
+            const result = await API.resolveConflict(payload);
+            if (result.merge_completed) {
+                UI.showToast("Sync Complete", "success");
+                UI.closeModal();
+                await refreshFileList();
+            } else {
+                await showConflicts();
+            }
+        } catch (e) {
+            UI.showToast(e.message, "error");
+        }
+    }, async () => {
+        await API.abortMerge();
+        UI.closeModal();
+        UI.showToast("Sync aborted", "info");
+        await refreshFileList();
+    });
+}
+
+async function runPublish(path = null, paths = null, selectedMessage = null) {
     const isSingle = !!path;
-    const msg = isSingle
-        ? "このファイルの変更をGitHubにPushして公開しますか？"
-        : "全ての変更をGitHubにPushして公開しますか？";
 
-    if (!confirm(msg)) return;
+    if (editorialWorkflow) {
+        if (isSingle) {
+            await requestReview(path);
+        } else {
+            await showWorkflow();
+        }
+        return;
+    }
+
+    // Publishing from the sidebar lets the editor pick exactly which changes go out
+    if (!isSingle && paths === null) {
+        try {
+            const changes = await API.fetchChanges();
+            UI.showChangesModal(changes, (selected, message) => runPublish(null, selected, message));
+        } catch (e) {
+            UI.showToast("Failed to fetch changes", "error");
+        }
+        return;
+    }
+
+    let message = selectedMessage;
+    if (message === null) {
+        // Optional commit message; leaving it empty uses the configured template
+        message = prompt("このファイルの変更をGitHubにPushして公開しますか？\n（コミットメッセージ：空欄でデフォルト）", "");
+        if (message === null) return;
+    }
 
     // UI Feedback
     let btnSelector = 'button[onclick="runPublish()"]';
@@ -133,13 +319,16 @@ async function runPublish(path = null) {
     }
 
     try {
-        const data = await API.runPublish(path);
+        const data = await API.runPublish(path, message.trim(), paths || []);
         if (data.status === 'ok') {
             UI.showToast("Published Successfully! 🚀", "success");
             // Refresh file list to update dirty flags
             await refreshFileList();
         } else {
-            UI.showToast("Publish Error: " + data.log, "error");
+            const detail = data.conflicts && data.conflicts.length
+                ? "Conflicts: " + data.conflicts.join(", ")
+                : data.log;
+            UI.showToast("Publish Error: " + detail, "error");
         }
     } catch (e) {
         UI.showToast("Network Error", "error");
@@ -151,6 +340,62 @@ async function runPublish(path = null) {
     }
 }
 
+async function showWorkflow() {
+    try {
+        const entries = await API.fetchWorkflowEntries();
+        UI.showWorkflowModal(entries, {
+            onRequestReview: requestReview,
+            onStatus: setWorkflowStatus,
+            onMerge: mergeWorkflowEntry,
+        });
+    } catch (e) {
+        UI.showToast("Failed to fetch workflow entries", "error");
+    }
+}
+
+async function requestReview(path) {
+    try {
+        const data = await API.publishWorkflowEntry(path);
+        if (data.status === 'ok') {
+            UI.showToast("Review requested 📝", "success");
+        } else {
+            UI.showToast("Review Request Error: " + (data.error || data.log), "error");
+        }
+    } catch (e) {
+        UI.showToast("Network Error", "error");
+    }
+}
+
+async function setWorkflowStatus(path, status) {
+    try {
+        const data = await API.updateWorkflowStatus(path, status);
+        if (data.status === 'ok') {
+            UI.showToast("Status updated", "success");
+            await showWorkflow();
+        } else {
+            UI.showToast("Status Error: " + data.error, "error");
+        }
+    } catch (e) {
+        UI.showToast("Network Error", "error");
+    }
+}
+
+async function mergeWorkflowEntry(path) {
+    if (!confirm(`${path} を公開しますか？`)) return;
+    try {
+        const data = await API.mergeWorkflowEntry(path);
+        if (data.status === 'ok') {
+            UI.showToast("Published Successfully! 🚀", "success");
+            await refreshFileList();
+            await showWorkflow();
+        } else {
+            UI.showToast("Publish Error: " + (data.error || data.log), "error");
+        }
+    } catch (e) {
+        UI.showToast("Network Error", "error");
+    }
+}
+
 async function publishFile() {
     const currentPath = Editor.getCurrentPath();
     if (!currentPath) {
@@ -5,17 +5,31 @@ let currentPath = "";
 let currentData = null;
 let cmsConfig = null;
 let autoSaveTimer = null;
+// Autosave writes every edit to the working tree, so it is only used when
+// unsaved content can't be shown in a draft preview instead
+let autoSaveEnabled = false;
 let lastSavedPayload = "";
+let lastSavedAt = 0;
 
 export function getCurrentPath() {
     return currentPath;
 }
 
+// Reports whether the editor wrote its file in the last few seconds, so the
+// watcher's notification about that write can be told apart from others.
+export function savedRecently() {
+    return Date.now() - lastSavedAt < 5000;
+}
+
+export function hasUnsavedChanges() {
+    return !!currentPath && JSON.stringify(getPayload()) !== lastSavedPayload;
+}
+
 export function setConfig(cfg) {
     cmsConfig = cfg;
 }
 
-export function initAutoSave() {
+export async function initAutoSave() {
     const editor = document.getElementById('editor');
     const fmContainer = document.getElementById('fm-container');
 
@@ -24,10 +38,21 @@ export function initAutoSave() {
         fmContainer.addEventListener('input', triggerAutoSave);
         fmContainer.addEventListener('change', triggerAutoSave);
     }
+
+    try {
+        const status = await API.fetchDraftPreviewStatus();
+        autoSaveEnabled = !status.enabled;
+    } catch (e) {
+        console.warn("[AutoSave] Draft preview status unknown, autosave stays off:", e);
+    }
 }
 
 function triggerAutoSave() {
     if (!currentPath) return;
+    if (!autoSaveEnabled) {
+        updateSaveStatus(hasUnsavedChanges() ? "Unsaved changes" : "", "");
+        return;
+    }
     if (autoSaveTimer) clearTimeout(autoSaveTimer);
 
     // Debounce 3 seconds
@@ -66,6 +91,7 @@ export async function execAutoSave() {
     try {
         await API.saveArticle(payloadObj);
         lastSavedPayload = payloadStr;
+        lastSavedAt = Date.now();
         console.log("[AutoSave] Saved:", currentPath);
         updateSaveStatus("Saved", "saved");
         reloadPreviewIfNeeded();
@@ -75,6 +101,25 @@ export async function execAutoSave() {
     }
 }
 
+// Shows unsaved changes in the draft preview without writing them to the
+// repository. Nothing is saved when that fails.
+export async function previewDraft() {
+    if (!currentPath) return;
+
+    const payload = getPayload();
+    if (JSON.stringify(payload) === lastSavedPayload) {
+        UI.setPreviewUrl(currentPath);
+        return;
+    }
+    try {
+        const preview = await API.updateDraftPreview(payload);
+        UI.showPreviewUrl(preview.url);
+    } catch (e) {
+        console.error("[DraftPreview] Failed:", e);
+        UI.showToast("Draft preview failed: " + e.message, "error");
+    }
+}
+
 export async function loadFile(path) {
     if (autoSaveTimer) clearTimeout(autoSaveTimer);
 
@@ -122,6 +167,7 @@ export async function saveFile() {
         const payload = getPayload();
         await API.saveArticle(payload);
         lastSavedPayload = JSON.stringify(payload);
+        lastSavedAt = Date.now();
         updateSaveStatus("Saved", "saved");
         UI.showToast("File saved successfully", "success");
         reloadPreviewIfNeeded();
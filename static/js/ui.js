@@ -154,6 +154,7 @@ function renderCollectionGroup(container, label, files) {
     files.forEach(f => {
         const div = document.createElement('div');
         div.className = 'file-item';
+        div.dataset.path = f.path;
         div.style.paddingLeft = '20px';
 
         const titleDiv = document.createElement('div');
@@ -163,6 +164,10 @@ function renderCollectionGroup(container, label, files) {
         if (f.is_dirty) {
             titleText = "✎ " + titleText;
             titleDiv.style.color = "#e2c08d";
+        } else if (f.is_unpushed) {
+            // Committed locally, waiting for a push
+            titleText = "⬆ " + titleText;
+            titleDiv.style.color = "#8db9e2";
         }
         titleDiv.textContent = titleText;
 
@@ -173,6 +178,7 @@ function renderCollectionGroup(container, label, files) {
 
         div.appendChild(titleDiv);
         div.appendChild(pathDiv);
+        renderHugoIssues(div);
 
         // グローバル関数 loadFile を呼び出す
         div.onclick = () => window.loadFile(f.path);
@@ -182,6 +188,55 @@ function renderCollectionGroup(container, label, files) {
     container.appendChild(details);
 }
 
+// Errors and warnings hugo reported for articles, by content path
+const hugoIssues = new Map();
+
+export function addHugoIssue(issue) {
+    if (!issue.path) return;
+    const issues = hugoIssues.get(issue.path) || [];
+    // A reconnecting stream replays the issues of the current build
+    if (issues.some(i => i.time === issue.time && i.message === issue.message)) return;
+    issues.push(issue);
+    hugoIssues.set(issue.path, issues);
+    updateHugoIssues(issue.path);
+}
+
+// A new build of source replaces the issues of its previous build
+export function clearHugoIssues(source) {
+    for (const [path, issues] of hugoIssues) {
+        const rest = issues.filter(i => i.source !== source);
+        if (rest.length) {
+            hugoIssues.set(path, rest);
+        } else {
+            hugoIssues.delete(path);
+        }
+        updateHugoIssues(path);
+    }
+}
+
+function updateHugoIssues(path) {
+    document.querySelectorAll('.file-item').forEach(div => {
+        if (div.dataset.path === path) renderHugoIssues(div);
+    });
+}
+
+function renderHugoIssues(div) {
+    const old = div.querySelector('.hugo-issue');
+    if (old) old.remove();
+
+    const issues = hugoIssues.get(div.dataset.path);
+    if (!issues || !issues.length) return;
+
+    const hasError = issues.some(i => i.type === 'error');
+    const marker = document.createElement('div');
+    marker.className = 'hugo-issue';
+    marker.style.fontSize = '12px';
+    marker.style.color = hasError ? '#f48771' : '#cca700';
+    marker.textContent = (hasError ? "✖ " : "⚠ ") + issues.map(i => i.line ? `line ${i.line}` : i.type).join(", ");
+    marker.title = issues.map(i => i.message).join("\n");
+    div.appendChild(marker);
+}
+
 function getCollectionForPath(path, config) {
     if (!config || !config.collections) return null;
     for (const col of config.collections) {
@@ -381,9 +436,23 @@ export function collectFrontMatter() {
     return fm;
 }
 
-export function setPreviewUrl(path) {
+export function showPreviewUrl(url) {
     const frame = document.getElementById('preview-frame');
-    let previewPath = path.replace(/\.md$/, "");
+    frame.src = url + (url.includes("?") ? "&" : "?") + "t=" + Date.now();
+}
+
+export async function setPreviewUrl(path) {
+    const frame = document.getElementById('preview-frame');
+    try {
+        // Resolved from the site's permalinks, slug/url and languages
+        const preview = await API.fetchPreviewUrl(path);
+        showPreviewUrl(preview.url);
+        return;
+    } catch (e) {
+        console.warn("Preview URL resolution failed, guessing from the path", e);
+    }
+
+    let previewPath = path.replace(/\.[^./]+$/, "");
 
     if (previewPath.endsWith("/index") || previewPath.endsWith("/_index")) {
         previewPath = previewPath.substring(0, previewPath.lastIndexOf("/"));
@@ -526,6 +595,290 @@ export function showCreationModal(config, onCreate) {
     body.appendChild(btnDiv);
 }
 
+export function showConflictModal(conflicts, onResolve, onAbort) {
+    const overlay = document.getElementById('modal-overlay');
+    const header = document.getElementById('modal-header');
+    const body = document.getElementById('modal-body');
+
+    header.querySelector('span').textContent = "Sync Conflicts";
+    body.innerHTML = '';
+    overlay.style.display = 'flex';
+
+    const versionText = (v) => {
+        if (!v.exists) return "(deleted)";
+        if (v.frontmatter) {
+            return JSON.stringify(v.frontmatter, null, 2) + "\n\n" + v.body;
+        }
+        return v.content;
+    };
+
+    conflicts.forEach(conflict => {
+        const section = document.createElement('div');
+        section.style.marginBottom = '20px';
+        section.innerHTML = `<strong>${conflict.path}</strong>`;
+
+        const panes = document.createElement('div');
+        panes.style.display = 'flex';
+        panes.style.gap = '10px';
+        [['Base', conflict.base], ['Ours', conflict.ours], ['Theirs', conflict.theirs]].forEach(([label, version]) => {
+            const pane = document.createElement('div');
+            pane.style.flex = '1';
+            pane.style.minWidth = '0';
+            const pre = document.createElement('pre');
+            pre.style.whiteSpace = 'pre-wrap';
+            pre.style.fontSize = '12px';
+            pre.textContent = versionText(version);
+            pane.innerHTML = `<em>${label}</em>`;
+            pane.appendChild(pre);
+            panes.appendChild(pane);
+        });
+        section.appendChild(panes);
+
+        const manual = document.createElement('textarea');
+        manual.className = 'fm-input';
+        manual.rows = 8;
+        manual.value = conflict.ours.exists ? conflict.ours.content : (conflict.theirs.content || '');
+        section.appendChild(manual);
+
+        const actions = document.createElement('div');
+        actions.style.textAlign = 'right';
+        actions.style.marginTop = '5px';
+        [['Use Ours', 'ours'], ['Use Theirs', 'theirs'], ['Save Manual Merge', 'manual']].forEach(([label, resolution]) => {
+            const btn = document.createElement('button');
+            btn.className = 'action-btn secondary';
+            btn.style.marginLeft = '5px';
+            btn.textContent = label;
+            btn.onclick = () => onResolve({
+                path: conflict.path,
+                resolution,
+                content: resolution === 'manual' ? manual.value : undefined
+            });
+            actions.appendChild(btn);
+        });
+        section.appendChild(actions);
+        body.appendChild(section);
+    });
+
+    const abortBtn = document.createElement('button');
+    abortBtn.className = 'action-btn danger';
+    abortBtn.textContent = 'Abort Sync';
+    abortBtn.onclick = onAbort;
+    body.appendChild(abortBtn);
+}
+
+export function showChangesModal(changes, onPublish) {
+    const overlay = document.getElementById('modal-overlay');
+    const header = document.getElementById('modal-header');
+    const body = document.getElementById('modal-body');
+
+    header.querySelector('span').textContent = "Publish Changes";
+    body.innerHTML = '';
+    overlay.style.display = 'flex';
+
+    if (!changes || changes.length === 0) {
+        body.innerHTML = '<p>No changes to publish.</p>';
+        return;
+    }
+
+    const list = document.createElement('div');
+    changes.forEach(change => {
+        const row = document.createElement('label');
+        row.style.display = 'block';
+        row.style.marginBottom = '4px';
+
+        const checkbox = document.createElement('input');
+        checkbox.type = 'checkbox';
+        checkbox.checked = change.kind === 'content';
+        checkbox.value = change.path;
+        row.appendChild(checkbox);
+
+        const text = document.createElement('span');
+        text.textContent = ` [${change.type}] ${change.old_path ? change.old_path + ' → ' : ''}${change.path}`;
+        row.appendChild(text);
+        list.appendChild(row);
+    });
+    body.appendChild(list);
+
+    const note = document.createElement('p');
+    note.style.fontSize = '12px';
+    note.style.color = '#888';
+    note.textContent = '選択した記事が参照しているメディアは自動的に含まれます。';
+    body.appendChild(note);
+
+    const message = document.createElement('input');
+    message.className = 'fm-input';
+    message.placeholder = 'Commit message (optional)';
+    body.appendChild(message);
+
+    const btnDiv = document.createElement('div');
+    btnDiv.style.marginTop = '20px';
+    btnDiv.style.textAlign = 'right';
+
+    const publishBtn = document.createElement('button');
+    publishBtn.className = 'action-btn danger';
+    publishBtn.textContent = '🚀 Publish Selected';
+    publishBtn.onclick = () => {
+        const selected = Array.from(list.querySelectorAll('input:checked')).map(cb => cb.value);
+        if (selected.length === 0) {
+            showToast("Nothing selected", "warning");
+            return;
+        }
+        closeModal();
+        onPublish(selected, message.value);
+    };
+    btnDiv.appendChild(publishBtn);
+    body.appendChild(btnDiv);
+}
+
+const workflowStatusLabels = {
+    draft: 'Draft',
+    pending_review: 'In Review',
+    pending_publish: 'Ready',
+};
+
+// Editorial workflow entries; handlers has onRequestReview(path),
+// onStatus(path, status) and onMerge(path).
+export function showWorkflowModal(entries, handlers) {
+    const overlay = document.getElementById('modal-overlay');
+    const header = document.getElementById('modal-header');
+    const body = document.getElementById('modal-body');
+
+    header.querySelector('span').textContent = "Editorial Workflow";
+    body.innerHTML = '';
+    overlay.style.display = 'flex';
+
+    if (!entries || entries.length === 0) {
+        body.innerHTML = '<p>No drafts in the workflow.</p>';
+        return;
+    }
+
+    entries.forEach(entry => {
+        const row = document.createElement('div');
+        row.style.display = 'flex';
+        row.style.alignItems = 'center';
+        row.style.gap = '8px';
+        row.style.marginBottom = '8px';
+
+        const info = document.createElement('div');
+        info.style.flex = '1';
+        const title = document.createElement('div');
+        title.textContent = entry.title || entry.path;
+        info.appendChild(title);
+        const meta = document.createElement('div');
+        meta.style.fontSize = '12px';
+        meta.style.color = '#888';
+        meta.textContent = entry.path;
+        if (entry.pr_url) {
+            const link = document.createElement('a');
+            link.href = entry.pr_url;
+            link.target = '_blank';
+            link.textContent = ` #${entry.pr_number}`;
+            meta.appendChild(link);
+        }
+        info.appendChild(meta);
+        row.appendChild(info);
+
+        if (!entry.pr_number) {
+            const reviewBtn = document.createElement('button');
+            reviewBtn.className = 'action-btn';
+            reviewBtn.textContent = '📝 Request Review';
+            reviewBtn.onclick = async () => {
+                closeModal();
+                await handlers.onRequestReview(entry.path);
+            };
+            row.appendChild(reviewBtn);
+        } else {
+            const select = document.createElement('select');
+            Object.entries(workflowStatusLabels).forEach(([value, label]) => {
+                const option = document.createElement('option');
+                option.value = value;
+                option.textContent = label;
+                option.selected = value === entry.status;
+                select.appendChild(option);
+            });
+            select.onchange = () => handlers.onStatus(entry.path, select.value);
+            row.appendChild(select);
+
+            const mergeBtn = document.createElement('button');
+            mergeBtn.className = 'action-btn danger';
+            mergeBtn.textContent = '🚀 Publish';
+            mergeBtn.disabled = entry.status !== 'pending_publish';
+            mergeBtn.onclick = () => handlers.onMerge(entry.path);
+            row.appendChild(mergeBtn);
+        }
+        body.appendChild(row);
+    });
+}
+
+// Full-text search; onSearch(query) resolves to a SearchResult and
+// onSelect(path) opens a hit.
+export function showSearchModal(onSearch, onSelect) {
+    const overlay = document.getElementById('modal-overlay');
+    const header = document.getElementById('modal-header');
+    const body = document.getElementById('modal-body');
+
+    header.querySelector('span').textContent = "Search";
+    body.innerHTML = '';
+    overlay.style.display = 'flex';
+
+    const input = document.createElement('input');
+    input.className = 'fm-input';
+    input.type = 'search';
+    input.placeholder = 'Search titles, bodies and front matter';
+    body.appendChild(input);
+
+    const status = document.createElement('p');
+    status.style.fontSize = '12px';
+    status.style.color = '#888';
+    body.appendChild(status);
+
+    const results = document.createElement('div');
+    body.appendChild(results);
+
+    let timer = null;
+    let latest = 0;
+    input.addEventListener('input', () => {
+        clearTimeout(timer);
+        timer = setTimeout(async () => {
+            const query = input.value.trim();
+            const request = ++latest;
+            results.innerHTML = '';
+            status.textContent = '';
+            if (!query) return;
+            try {
+                const result = await onSearch(query);
+                if (request !== latest) return; // A newer query is on its way
+                status.textContent = `${result.total} article(s)`;
+                result.hits.forEach(hit => {
+                    const item = document.createElement('div');
+                    item.className = 'file-item search-hit';
+
+                    const title = document.createElement('div');
+                    title.style.fontWeight = 'bold';
+                    title.textContent = hit.title;
+                    const meta = document.createElement('div');
+                    meta.style.fontSize = '11px';
+                    meta.style.color = '#888';
+                    meta.textContent = `${hit.path} · ${hit.field}`;
+                    const snippet = document.createElement('div');
+                    // Escaped by the server apart from the <mark> tags
+                    snippet.innerHTML = hit.snippet;
+
+                    item.append(title, meta, snippet);
+                    item.onclick = () => {
+                        closeModal();
+                        onSelect(hit.path);
+                    };
+                    results.appendChild(item);
+                });
+            } catch (e) {
+                status.textContent = e.message;
+            }
+        }, 250);
+    });
+    input.focus();
+}
+
 export function closeModal() {
     document.getElementById('modal-overlay').style.display = 'none';
 }
@@ -599,7 +952,8 @@ export async function showMediaLibrary(onSelect, collectionName = null, currentP
     const tabStatic = createTab('static', 'Static');
     const tabArticle = createTab('content', 'Article');
 
-    const isBundle = currentPath && (currentPath.endsWith('/index.md') || currentPath.endsWith('/_index.md'));
+    // index.md, _index.org, ...
+    const isBundle = currentPath && /\/_?index\.[^./]+$/.test(currentPath);
 
     if (!isBundle) {
         tabArticle.disabled = true;